@@ -0,0 +1,97 @@
+package noderunscript
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// splitArgs splits a string into arguments following POSIX shell rules for
+// whitespace, single quotes, double quotes and backslash escapes.
+func splitArgs(value string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\' && quote == 0:
+			escaped, inArg = true, true
+		case r == '\\' && quote == '"':
+			escaped = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, value)
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %q", value)
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// quoteArgs joins arguments into a string that a POSIX shell would split back
+// into the same arguments.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsFunc(arg, func(r rune) bool {
+			return unicode.IsSpace(r) || strings.ContainsRune(`"'\$`+"`"+`!*?[]{}()<>|&;#~`, r)
+		}) {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// scriptEnvName converts a script name into the form used in environment
+// variable names by upper-casing it and replacing every character other than
+// letters and digits with an underscore.
+func scriptEnvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return unicode.ToUpper(r)
+		}
+
+		return '_'
+	}, name)
+}
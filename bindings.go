@@ -0,0 +1,168 @@
+package noderunscript
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
+)
+
+//go:generate faux --interface BindingResolver --output fakes/binding_resolver.go
+type BindingResolver interface {
+	Resolve(typ, provider, platformDir string) ([]servicebindings.Binding, error)
+}
+
+// ScriptEnvBindingType is the type of the service bindings whose entries are
+// set as environment variables, named after the entry, for every script.
+const ScriptEnvBindingType = "node-run-script"
+
+// bindingEnv resolves the service bindings available to scripts. It returns
+// the environment variables, in KEY=VALUE form, that expose them, the binding
+// entries to link into the home directory and the binding values that must be
+// masked in the build output.
+func bindingEnv(resolver BindingResolver, platformDir string) ([]string, []string, []string, error) {
+	var (
+		variables []string
+		homeFiles []string
+		secrets   []string
+	)
+
+	// Yarn Classic reads ~/.yarnrc and Yarn Berry ~/.yarnrc.yml on top of the
+	// rc files of the project, so the yarnrc binding is linked into the home
+	// directory rather than named by a variable.
+	rcFiles := []struct {
+		typ      string
+		variable string
+		files    []string
+	}{
+		{typ: "npmrc", variable: "NPM_CONFIG_USERCONFIG", files: []string{".npmrc"}},
+		{typ: "yarnrc", files: []string{".yarnrc.yml", ".yarnrc"}},
+	}
+
+	for _, rc := range rcFiles {
+		bindings, err := resolver.Resolve(rc.typ, "", platformDir)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to resolve %s service binding: %w", rc.typ, err)
+		}
+
+		if len(bindings) > 1 {
+			return nil, nil, nil, fmt.Errorf("found more than one service binding of type %q", rc.typ)
+		}
+
+		if len(bindings) == 0 {
+			continue
+		}
+
+		binding := bindings[0]
+		index := slices.IndexFunc(rc.files, func(file string) bool { return binding.Entries[file] != nil })
+		if index < 0 {
+			return nil, nil, nil, fmt.Errorf("service binding %q of type %q does not contain a %s entry", binding.Name, rc.typ, strings.Join(rc.files, " or "))
+		}
+
+		content, err := binding.Entries[rc.files[index]].ReadString()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read service binding %q: %w", binding.Name, err)
+		}
+
+		file := filepath.Join(binding.Path, rc.files[index])
+		if rc.variable != "" {
+			variables = append(variables, rc.variable+"="+file)
+		} else {
+			homeFiles = append(homeFiles, file)
+		}
+		secrets = append(secrets, rcSecrets(content)...)
+	}
+
+	bindings, err := resolver.Resolve(ScriptEnvBindingType, "", platformDir)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to resolve %s service binding: %w", ScriptEnvBindingType, err)
+	}
+
+	for _, binding := range bindings {
+		var names []string
+		for name := range binding.Entries {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			value, err := binding.Entries[name].ReadString()
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to read service binding %q: %w", binding.Name, err)
+			}
+			value = strings.TrimRight(value, "\r\n")
+
+			variables = mergeEnv(variables, []string{name + "=" + value})
+			if len(value) >= minRedactLength {
+				secrets = append(secrets, value)
+			}
+		}
+	}
+
+	return variables, homeFiles, secrets, nil
+}
+
+// linkHomeFiles links each file into the home directory under its own name,
+// refusing to replace files that are already there. It returns the links,
+// which are removed again by unlinkHomeFiles once the scripts have run.
+func linkHomeFiles(files []string) ([]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the home directory: %w", err)
+	}
+
+	var links []string
+	for _, file := range files {
+		link := filepath.Join(home, filepath.Base(file))
+		if _, err := os.Lstat(link); err == nil {
+			unlinkHomeFiles(links)
+			return nil, fmt.Errorf("cannot link service binding to %s: the file already exists", link)
+		}
+
+		if err := os.Symlink(file, link); err != nil {
+			unlinkHomeFiles(links)
+			return nil, fmt.Errorf("failed to link service binding to %s: %w", link, err)
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// unlinkHomeFiles removes the links made by linkHomeFiles.
+func unlinkHomeFiles(links []string) {
+	for _, link := range links {
+		_ = os.Remove(link)
+	}
+}
+
+// rcSecrets returns the values of the settings in a .npmrc or .yarnrc(.yml)
+// file whose keys suggest that they hold credentials.
+func rcSecrets(content string) []string {
+	var secrets []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			key, value, found = strings.Cut(line, ": ")
+		}
+
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		// Settings such as //registry.npmjs.org/:_authToken are scoped with
+		// slashes, which the patterns do not match across.
+		if found && len(value) >= minRedactLength && matchesAny(path.Base(strings.TrimSpace(key)), rcSecretPatterns) {
+			secrets = append(secrets, value)
+		}
+	}
+
+	return secrets
+}
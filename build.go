@@ -1,10 +1,16 @@
 package noderunscript
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/paketo-buildpacks/libnodejs"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
 	"github.com/paketo-buildpacks/packit/v2/pexec"
@@ -16,40 +22,181 @@ type Executable interface {
 	Execute(execution pexec.Execution) error
 }
 
-func Build(npm Executable, yarn Executable, clock chronos.Clock, logger scribe.Logger, env Environment) packit.BuildFunc {
+func Build(managers *PackageManagerRegistry, bindingResolver BindingResolver, clock chronos.Clock, logger scribe.Logger, env Environment) packit.BuildFunc {
 	return func(context packit.BuildContext) (packit.BuildResult, error) {
 		logger.Title("%s %s", context.BuildpackInfo.Name, context.BuildpackInfo.Version)
 
-		projectDir, err := libnodejs.FindProjectPath(context.WorkingDir)
+		projects, err := findProjects(context.WorkingDir, env)
 		if err != nil {
 			return packit.BuildResult{}, err
 		}
-		scripts, packageManager, err := ScriptsToRun(projectDir, env.NodeRunScripts)
+
+		bindings, homeFiles, secrets, err := bindingEnv(bindingResolver, context.Platform.Path)
 		if err != nil {
-			return packit.BuildResult{}, fmt.Errorf("failed to find scripts to run: %w", err)
+			return packit.BuildResult{}, err
 		}
 
-		exec := npm
-		if packageManager == "yarn" {
-			exec = yarn
+		homeLinks, err := linkHomeFiles(homeFiles)
+		if err != nil {
+			return packit.BuildResult{}, err
 		}
+		defer unlinkHomeFiles(homeLinks)
+		redactPatterns := append(slices.Clone(DefaultRedactPatterns), env.RedactPatterns...)
+
+		// projectBuild holds what is needed to run the scripts of a project.
+		type projectBuild struct {
+			project project
+			scripts []Script
+			loaded  []string
+			runner  *scriptRunner
+		}
+
+		// Every project is resolved before any script runs, so that a
+		// misconfigured project fails the build early.
+		var (
+			builds []projectBuild
+			cache  *outputCache
+		)
+		for _, project := range projects {
+			scripts, packageManager, _, err := ScriptsToRun(project.Dir, env, managers)
+			if err != nil {
+				return packit.BuildResult{}, project.wrap(fmt.Errorf("failed to find scripts to run: %w", err))
+			}
+
+			// The cache layer is only used by projects with scripts that
+			// declare their outputs.
+			var tools string
+			if slices.ContainsFunc(scripts, func(script Script) bool { return len(script.Outputs) > 0 }) {
+				if cache == nil {
+					cache, err = newOutputCache(context.Layers, env.ForceRebuild)
+					if err != nil {
+						return packit.BuildResult{}, fmt.Errorf("failed to get layer: %w", err)
+					}
+				}
+
+				tools = toolVersions(managers.Executable(packageManager.Name()), packageManager, project.Dir)
+			}
+
+			extraEnv, err := packageManager.Env(project.Dir)
+			if err != nil {
+				return packit.BuildResult{}, project.wrap(fmt.Errorf("failed to determine %s environment: %w", packageManager.Name(), err))
+			}
 
-		logger.Process("Executing build process")
+			dotenv, loaded, err := loadDotenvFiles(project.Dir, env.DotenvFiles)
+			if err != nil {
+				return packit.BuildResult{}, project.wrap(fmt.Errorf("failed to load dotenv files: %w", err))
+			}
+
+			// Default variables and those from dotenv files never override the
+			// inherited environment.
+			var baseEnv []string
+			for _, variable := range mergeEnv(defaultEnv(env), dotenv) {
+				key, _, _ := strings.Cut(variable, "=")
+				if _, ok := os.LookupEnv(key); !ok {
+					baseEnv = append(baseEnv, variable)
+				}
+			}
+
+			builds = append(builds, projectBuild{
+				project: project,
+				scripts: scripts,
+				loaded:  loaded,
+				runner: &scriptRunner{
+					executable:      managers.Executable(packageManager.Name()),
+					packageManager:  packageManager,
+					project:         project.Name,
+					projectDir:      project.Dir,
+					baseEnv:         baseEnv,
+					bindings:        bindings,
+					extraEnv:        extraEnv,
+					secrets:         secrets,
+					redactPatterns:  redactPatterns,
+					continueOnError: env.ContinueOnError,
+					clock:           clock,
+					logger:          logger,
+					cache:           cache,
+					tools:           tools,
+				},
+			})
+		}
+
+		var toolCaches *toolCache
+		if !env.DisableToolCaches {
+			toolCaches, err = newToolCache(context.Layers, env, clock, logger)
+			if err != nil {
+				return packit.BuildResult{}, fmt.Errorf("failed to get layer: %w", err)
+			}
+		}
+
+		var failures, warnings []ScriptFailure
 		duration, err := clock.Measure(func() error {
-			for _, script := range scripts {
-				logger.Subprocess("Running '%s %s %s'", packageManager, "run", script)
-
-				err := exec.Execute(pexec.Execution{
-					Dir:    projectDir,
-					Args:   []string{"run", script},
-					Stdout: logger.ActionWriter,
-					Stderr: logger.ActionWriter,
-				})
-				if err != nil {
-					return err
+			for _, build := range builds {
+				if build.project.Name == "" {
+					logger.Process("Executing build process")
+				} else {
+					logger.Process("Executing build process for %s", build.project.Name)
+				}
+
+				if toolCaches != nil {
+					restored, err := toolCaches.restore(build.project.Name, build.project.Dir)
+					if err != nil {
+						return build.project.wrap(err)
+					}
+
+					if len(restored) > 0 {
+						logger.Subprocess("Restored tool caches: %s", strings.Join(restored, ", "))
+						logger.Break()
+					}
+				}
+
+				logger.Debug.Subprocess("Script dependency graph:")
+				for _, script := range build.scripts {
+					if len(script.DependsOn) > 0 {
+						logger.Debug.Action("%s -> %s", script.label(), strings.Join(script.DependsOn, ", "))
+					} else {
+						logger.Debug.Action("%s", script.label())
+					}
+				}
+				logger.Debug.Break()
+
+				if len(build.loaded) > 0 {
+					logger.Subprocess("Loading environment from %s", strings.Join(build.loaded, ", "))
+					logger.Break()
+				}
+
+				if len(bindings) > 0 {
+					var names []string
+					for _, variable := range bindings {
+						name, _, _ := strings.Cut(variable, "=")
+						names = append(names, name)
+					}
+					logger.Subprocess("Setting %s from service bindings", strings.Join(names, ", "))
+					logger.Break()
+				}
+
+				for _, link := range homeLinks {
+					logger.Subprocess("Linking ~/%s to its service binding", filepath.Base(link))
+					logger.Break()
 				}
 
-				logger.Break()
+				var err error
+				if env.Parallel {
+					concurrency := env.Concurrency
+					if concurrency == 0 {
+						concurrency = runtime.NumCPU()
+					}
+
+					err = build.runner.runParallel(build.scripts, concurrency)
+				} else {
+					err = build.runner.runSequential(build.scripts)
+				}
+
+				failures = append(failures, build.runner.failures...)
+				warnings = append(warnings, build.runner.warnings...)
+
+				if err != nil {
+					return build.project.wrap(err)
+				}
 			}
 
 			return nil
@@ -58,9 +205,86 @@ func Build(npm Executable, yarn Executable, clock chronos.Clock, logger scribe.L
 			return packit.BuildResult{}, err
 		}
 
+		if len(failures) > 0 || len(warnings) > 0 {
+			logFailureSummary(logger, failures, warnings)
+		}
+
+		if len(failures) > 0 {
+			return packit.BuildResult{}, ScriptFailures(failures)
+		}
+
 		logger.Subprocess("Completed in %s", duration.Round(time.Millisecond))
 		logger.Break()
 
-		return packit.BuildResult{}, nil
+		var layers []packit.Layer
+		if cache != nil {
+			layer, err := cache.finish()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+			layers = append(layers, layer)
+		}
+
+		if toolCaches != nil {
+			for _, build := range builds {
+				dirs := []string{build.project.Dir}
+				for _, script := range build.scripts {
+					if script.Dir != "" && !slices.Contains(dirs, script.Dir) {
+						dirs = append(dirs, script.Dir)
+					}
+				}
+
+				paths, err := toolCaches.find(build.project.Dir, dirs)
+				if err != nil {
+					return packit.BuildResult{}, build.project.wrap(err)
+				}
+
+				if err := toolCaches.collect(build.project.Name, build.project.Dir, paths); err != nil {
+					return packit.BuildResult{}, build.project.wrap(err)
+				}
+			}
+
+			layer, err := toolCaches.finish()
+			if err != nil {
+				return packit.BuildResult{}, err
+			}
+
+			// The layer is left out while there is nothing to cache.
+			if len(layer.Metadata) > 0 {
+				layers = append(layers, layer)
+			}
+		}
+
+		// Outputs are moved last, so that the caches above are taken from
+		// the project directory as the scripts left it.
+		if len(env.LaunchOutputs) > 0 {
+			// With several projects, each output only needs to be created by
+			// one of them.
+			created := map[string]bool{}
+			for _, build := range builds {
+				for _, output := range env.LaunchOutputs {
+					layer, err := moveLaunchOutput(context.Layers, build.project, output, logger)
+					if err != nil {
+						if len(builds) > 1 && errors.Is(err, errLaunchOutputMissing) {
+							logger.Subprocess("Skipping %s, which the scripts of the project did not create", path.Join(build.project.Name, output.Path))
+							continue
+						}
+
+						return packit.BuildResult{}, build.project.wrap(err)
+					}
+					layers = append(layers, layer)
+					created[output.Path] = true
+				}
+			}
+
+			for _, output := range env.LaunchOutputs {
+				if !created[output.Path] {
+					return packit.BuildResult{}, fmt.Errorf("launch output %s was not created by the scripts of any project", output.Path)
+				}
+			}
+			logger.Break()
+		}
+
+		return packit.BuildResult{Layers: layers}, nil
 	}
 }
@@ -2,13 +2,18 @@ package noderunscript_test
 
 import (
 	"bytes"
+	gocontext "context"
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	noderunscript "github.com/paketo-buildpacks/node-run-script"
 	"github.com/paketo-buildpacks/node-run-script/fakes"
 	"github.com/paketo-buildpacks/packit/v2"
@@ -16,6 +21,7 @@ import (
 	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 	"github.com/sclevine/spec"
 
 	. "github.com/onsi/gomega"
@@ -38,6 +44,11 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		loggerBuffer *bytes.Buffer
 		npmExec      *fakes.Executable
 		yarnExec     *fakes.Executable
+		pnpmExec     *fakes.Executable
+		bunExec      *fakes.Executable
+		managers     *noderunscript.PackageManagerRegistry
+
+		bindingResolver *fakes.BindingResolver
 	)
 
 	it.Before(func() {
@@ -60,6 +71,15 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 
 		npmExec = &fakes.Executable{}
 		yarnExec = &fakes.Executable{}
+		pnpmExec = &fakes.Executable{}
+		bunExec = &fakes.Executable{}
+
+		managers = noderunscript.NewPackageManagerRegistry(noderunscript.NewNPM(), npmExec)
+		managers.Register(noderunscript.NewYarn(), yarnExec)
+		managers.Register(noderunscript.NewPNPM(), pnpmExec)
+		managers.Register(noderunscript.NewBun(), bunExec)
+
+		bindingResolver = &fakes.BindingResolver{}
 
 		timestamp = time.Now()
 		clock = chronos.NewClock(func() time.Time {
@@ -69,7 +89,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		loggerBuffer = bytes.NewBuffer(nil)
 		logger = scribe.NewLogger(loggerBuffer)
 
-		build = noderunscript.Build(npmExec, yarnExec, clock, logger, noderunscript.Environment{
+		build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
 			NodeRunScripts: "build",
 		})
 	})
@@ -130,6 +150,197 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when using yarn berry", func() {
+		var executions []pexec.Execution
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"packageManager": "yarn@4.1.0",
+				"scripts": {
+					"prebuild": "echo \"script prebuild running!\"",
+					"build": "echo \"script build running!\"",
+					"postbuild": "echo \"script postbuild running!\""
+				}
+			}`), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".pnp.cjs"), nil, 0600)).To(Succeed())
+
+			yarnExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				executions = append(executions, execution)
+				return nil
+			}
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts:      "build",
+				RunLifecycleScripts: true,
+			})
+		})
+
+		it("runs the lifecycle scripts explicitly when asked to", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(executions).To(HaveLen(3))
+			Expect(executions[0].Args).To(Equal([]string{"run", "prebuild"}))
+			Expect(executions[1].Args).To(Equal([]string{"run", "build"}))
+			Expect(executions[2].Args).To(Equal([]string{"run", "postbuild"}))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Running 'yarn run prebuild'"))
+		})
+	})
+
+	context("when using pnpm", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "pnpm-lock.yaml"), nil, 0600)).To(Succeed())
+		})
+
+		it("runs pnpm commands", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(npmExec.ExecuteCall.CallCount).To(Equal(0))
+			Expect(yarnExec.ExecuteCall.CallCount).To(Equal(0))
+			Expect(pnpmExec.ExecuteCall.CallCount).To(Equal(1))
+			Expect(pnpmExec.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"run", "build"}))
+			Expect(pnpmExec.ExecuteCall.Receives.Execution.Dir).To(Equal(workingDir))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Running 'pnpm run build'"))
+		})
+	})
+
+	context("when using bun", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "bun.lockb"), nil, 0600)).To(Succeed())
+		})
+
+		it("runs bun commands", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(npmExec.ExecuteCall.CallCount).To(Equal(0))
+			Expect(bunExec.ExecuteCall.CallCount).To(Equal(1))
+			Expect(bunExec.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"run", "build"}))
+			Expect(bunExec.ExecuteCall.Receives.Execution.Dir).To(Equal(workingDir))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Running 'bun run build'"))
+		})
+	})
+
+	context("when a custom package manager is registered", func() {
+		var (
+			customManager *fakes.PackageManager
+			customExec    *fakes.Executable
+		)
+
+		it.Before(func() {
+			customManager = &fakes.PackageManager{}
+			customManager.NameCall.Returns.String = "custom"
+			customManager.DetectCall.Returns.Bool = true
+			customManager.RunArgsCall.Stub = func(script string, args []string) []string {
+				return []string{"exec", "--script", script}
+			}
+			customManager.EnvCall.Returns.StringSlice = []string{"CUSTOM_VAR=some-value"}
+
+			customExec = &fakes.Executable{}
+			managers.Register(customManager, customExec)
+		})
+
+		it("runs commands with the custom package manager", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(customManager.DetectCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(customManager.EnvCall.Receives.WorkingDir).To(Equal(workingDir))
+
+			Expect(npmExec.ExecuteCall.CallCount).To(Equal(0))
+			Expect(customExec.ExecuteCall.CallCount).To(Equal(1))
+			Expect(customExec.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"exec", "--script", "build"}))
+			Expect(customExec.ExecuteCall.Receives.Execution.Dir).To(Equal(workingDir))
+			Expect(customExec.ExecuteCall.Receives.Execution.Env).To(ContainElement("CUSTOM_VAR=some-value"))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Running 'custom exec --script build'"))
+		})
+	})
+
+	context("when env var $BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER is set", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				PackageManager: "pnpm",
+			})
+		})
+
+		it("runs commands with the requested package manager", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(yarnExec.ExecuteCall.CallCount).To(Equal(0))
+			Expect(pnpmExec.ExecuteCall.CallCount).To(Equal(1))
+			Expect(pnpmExec.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"run", "build"}))
+		})
+	})
+
 	context("when env var $BP_NODE_RUN_SCRIPTS has spaces among commas", func() {
 		var executions []pexec.Execution
 		it.Before(func() {
@@ -138,7 +349,7 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 				return nil
 			}
 
-			build = noderunscript.Build(npmExec, yarnExec, clock, logger, noderunscript.Environment{
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
 				NodeRunScripts: "build, some-script",
 			})
 		})
@@ -165,25 +376,64 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
-	context("when there is a custom project path set", func() {
+	context("when env var $BP_NODE_RUN_SCRIPTS contains a pattern", func() {
+		var executions []pexec.Execution
 		it.Before(func() {
-			var err error
-			projectPath, err = os.MkdirTemp(workingDir, "custom-project-path")
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build:js": "echo \"script build:js running!\"",
+					"build:css": "echo \"script build:css running!\"",
+					"some-script": "echo \"script some-script running!\""
+				}
+			}`), 0600)).To(Succeed())
+
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				executions = append(executions, execution)
+				return nil
+			}
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build:*",
+			})
+		})
+
+		it("runs the matching scripts", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
 			Expect(err).NotTo(HaveOccurred())
-			base := path.Base(projectPath)
-			t.Setenv("BP_NODE_PROJECT_PATH", base)
 
-			customPath := filepath.Base(projectPath)
+			Expect(executions).To(HaveLen(2))
+			Expect(executions[0].Args).To(Equal([]string{"run", "build:js"}))
+			Expect(executions[1].Args).To(Equal([]string{"run", "build:css"}))
+		})
+	})
 
-			Expect(os.WriteFile(filepath.Join(workingDir, customPath, "yarn.lock"), nil, 0600)).To(Succeed())
-			Expect(fs.Move(filepath.Join(workingDir, "package.json"), filepath.Join(workingDir, customPath, "package.json"))).To(Succeed())
+	context("when environment variables are given for a script", func() {
+		it.Before(func() {
+			t.Setenv("INHERITED_VAR", "inherited-value")
+			t.Setenv("NODE_ENV", "development")
 
-			build = noderunscript.Build(npmExec, yarnExec, clock, logger, noderunscript.Environment{
-				NodeRunScripts: "build",
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build,some-script",
+				ScriptEnv: map[string]string{
+					"BUILD_NODE_ENV":  "production",
+					"BUILD_API_TOKEN": "some-token",
+				},
 			})
 		})
 
-		it("works and runs the correct commands", func() {
+		it("merges them on top of the inherited environment", func() {
 			_, err := build(packit.BuildContext{
 				WorkingDir: workingDir,
 				CNBPath:    cnbDir,
@@ -199,20 +449,25 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 			})
 			Expect(err).NotTo(HaveOccurred())
 
-			Expect(yarnExec.ExecuteCall.CallCount).To(Equal(1))
-			Expect(yarnExec.ExecuteCall.Receives.Execution.Args).To(
-				Equal([]string{"run", "build"}))
-			Expect(yarnExec.ExecuteCall.Receives.Execution.Dir).To(Equal(projectPath))
+			Expect(npmExec.ExecuteCall.CallCount).To(Equal(2))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("API_TOKEN=[REDACTED]"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("NODE_ENV=production"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("some-token"))
 		})
-	})
 
-	context("failure cases", func() {
-		context("when finding the scripts to run fails", func() {
+		context("when the script is run", func() {
+			var executions []pexec.Execution
+
 			it.Before(func() {
-				Expect(os.Remove(filepath.Join(workingDir, "package.json"))).To(Succeed())
+				executions = nil
+				npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					executions = append(executions, execution)
+					return nil
+				}
 			})
 
-			it("returns an error", func() {
+			it("only sets the variables for that script", func() {
 				_, err := build(packit.BuildContext{
 					WorkingDir: workingDir,
 					CNBPath:    cnbDir,
@@ -226,24 +481,64 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					},
 					Layers: packit.Layers{Path: layersDir},
 				})
-				Expect(err).To(MatchError(ContainSubstring("failed to find scripts to run")))
-				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(2))
+				Expect(executions[0].Env).To(ContainElements("INHERITED_VAR=inherited-value", "NODE_ENV=production", "API_TOKEN=some-token"))
+				Expect(executions[0].Env).NotTo(ContainElement("NODE_ENV=development"))
+				Expect(executions[1].Env).To(ContainElement("NODE_ENV=development"))
+				Expect(executions[1].Env).NotTo(ContainElement("API_TOKEN=some-token"))
 			})
 		})
+	})
 
-		context("when the script getting run has an error", func() {
+	context("when running scripts", func() {
+		it.Before(func() {
+			for _, key := range []string{"CI", "NODE_ENV", "SOURCE_DATE_EPOCH"} {
+				t.Setenv(key, "")
+				Expect(os.Unsetenv(key)).To(Succeed())
+			}
+		})
+
+		it("sets a default build environment", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(npmExec.ExecuteCall.Receives.Execution.Env).To(ContainElements(
+				"CI=true",
+				"NODE_ENV=production",
+				"SOURCE_DATE_EPOCH=315532800",
+				"npm_config_update_notifier=false",
+			))
+		})
+
+		context("when the variables are already set", func() {
 			it.Before(func() {
-				npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
-					_, err := fmt.Fprintln(execution.Stdout, "some stdout output")
-					Expect(err).To(Succeed())
-					_, err = fmt.Fprintln(execution.Stderr, "some stderr output")
-					Expect(err).To(Succeed())
+				t.Setenv("NODE_ENV", "development")
+				t.Setenv("CI", "false")
 
-					return fmt.Errorf("some execute error")
-				}
+				Expect(os.WriteFile(filepath.Join(workingDir, ".env"), []byte("CI=true\nNODE_ENV=staging\n"), 0600)).To(Succeed())
+
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts:  "build",
+					DotenvFiles:     []string{".env"},
+					SourceDateEpoch: "1700000000",
+				})
 			})
 
-			it("returns an error", func() {
+			it("does not override them", func() {
 				_, err := build(packit.BuildContext{
 					WorkingDir: workingDir,
 					CNBPath:    cnbDir,
@@ -257,11 +552,1869 @@ func testBuild(t *testing.T, context spec.G, it spec.S) {
 					},
 					Layers: packit.Layers{Path: layersDir},
 				})
-				Expect(err).To(MatchError("some execute error"))
+				Expect(err).NotTo(HaveOccurred())
 
-				Expect(loggerBuffer.String()).To(ContainSubstring("some stdout output"))
-				Expect(loggerBuffer.String()).To(ContainSubstring("some stderr output"))
+				environment := npmExec.ExecuteCall.Receives.Execution.Env
+				Expect(environment).To(ContainElements("CI=false", "NODE_ENV=development", "SOURCE_DATE_EPOCH=1700000000"))
+				Expect(environment).NotTo(ContainElement("NODE_ENV=production"))
+				Expect(environment).NotTo(ContainElement("NODE_ENV=staging"))
+			})
+		})
+
+		context("when the default environment is disabled", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts:    "build",
+					DisableDefaultEnv: true,
+				})
+			})
+
+			it("inherits the environment unchanged", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(npmExec.ExecuteCall.Receives.Execution.Env).To(BeNil())
 			})
 		})
 	})
+
+	context("when dotenv files are configured", func() {
+		it.Before(func() {
+			t.Setenv("INHERITED_VAR", "from-environment")
+
+			Expect(os.WriteFile(filepath.Join(workingDir, ".env"), []byte(strings.Join([]string{
+				"# shared defaults",
+				"API_URL=http://localhost",
+				"INHERITED_VAR=from-dotenv",
+				"export GREETING='hello # world'",
+				`MULTILINE="first\nsecond"`,
+				"SCRIPT_VAR=from-dotenv # trailing comment",
+			}, "\n")), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".env.production"), []byte("API_URL=https://example.com\n"), 0600)).To(Succeed())
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				DotenvFiles:    []string{".env", ".env.local", ".env.production"},
+				ScriptEnv: map[string]string{
+					"BUILD_SCRIPT_VAR": "from-script",
+				},
+			})
+		})
+
+		it("loads them underneath the inherited and script environments", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			environment := npmExec.ExecuteCall.Receives.Execution.Env
+			Expect(environment).To(ContainElements(
+				"API_URL=https://example.com",
+				"INHERITED_VAR=from-environment",
+				"GREETING=hello # world",
+				"MULTILINE=first\nsecond",
+				"SCRIPT_VAR=from-script",
+			))
+			Expect(environment).NotTo(ContainElement("INHERITED_VAR=from-dotenv"))
+			Expect(environment).NotTo(ContainElement("API_URL=http://localhost"))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Loading environment from .env, .env.production"))
+		})
+	})
+
+	context("when service bindings are present", func() {
+		var (
+			homeDir  string
+			yarnrcAt string
+		)
+
+		it.Before(func() {
+			var err error
+			homeDir, err = os.MkdirTemp("", "home")
+			Expect(err).NotTo(HaveOccurred())
+			t.Setenv("HOME", homeDir)
+
+			bindingResolver.ResolveCall.Stub = func(typ, provider, platformDir string) ([]servicebindings.Binding, error) {
+				switch typ {
+				case "npmrc":
+					return []servicebindings.Binding{{
+						Name: "some-npmrc",
+						Path: "/bindings/some-npmrc",
+						Type: "npmrc",
+						Entries: map[string]*servicebindings.Entry{
+							".npmrc": servicebindings.NewWithValue([]byte("registry=https://registry.example.com\n//registry.example.com/:_authToken=npm-secret\n")),
+						},
+					}}, nil
+				case "yarnrc":
+					return []servicebindings.Binding{{
+						Name: "some-yarnrc",
+						Path: "/bindings/some-yarnrc",
+						Type: "yarnrc",
+						Entries: map[string]*servicebindings.Entry{
+							".yarnrc.yml": servicebindings.NewWithValue([]byte("npmAuthToken: \"yarn-secret\"\n")),
+						},
+					}}, nil
+				case "node-run-script":
+					return []servicebindings.Binding{{
+						Name: "some-secrets",
+						Path: "/bindings/some-secrets",
+						Type: "node-run-script",
+						Entries: map[string]*servicebindings.Entry{
+							"API_TOKEN":  servicebindings.NewWithValue([]byte("generic-secret\n")),
+							"ASSETS_URL": servicebindings.NewWithValue([]byte("https://assets.example.com")),
+							"FLAG":       servicebindings.NewWithValue([]byte("1\n")),
+						},
+					}}, nil
+				}
+
+				return nil, nil
+			}
+
+			yarnrcAt = ""
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				yarnrcAt, _ = os.Readlink(filepath.Join(homeDir, ".yarnrc.yml"))
+
+				_, err := fmt.Fprintln(execution.Stdout, "using npm-secret and generic-secret")
+				Expect(err).To(Succeed())
+				_, err = fmt.Fprintln(execution.Stderr, "failed with yarn-secret after 1 attempt")
+				Expect(err).To(Succeed())
+
+				return nil
+			}
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(homeDir)).To(Succeed())
+		})
+
+		it("exposes the bindings to the scripts", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Platform: packit.Platform{Path: "some-platform-path"},
+				Layers:   packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(bindingResolver.ResolveCall.Receives.PlatformDir).To(Equal("some-platform-path"))
+			Expect(npmExec.ExecuteCall.Receives.Execution.Env).To(ContainElements(
+				"NPM_CONFIG_USERCONFIG=/bindings/some-npmrc/.npmrc",
+				"API_TOKEN=generic-secret",
+				"ASSETS_URL=https://assets.example.com",
+			))
+			Expect(npmExec.ExecuteCall.Receives.Execution.Env).NotTo(ContainElement(HavePrefix("YARN_RC_FILENAME=")))
+
+			// Yarn reads the home rc file on top of those of the project,
+			// so the link only exists while the scripts run.
+			Expect(yarnrcAt).To(Equal("/bindings/some-yarnrc/.yarnrc.yml"))
+			_, err = os.Lstat(filepath.Join(homeDir, ".yarnrc.yml"))
+			Expect(err).To(MatchError(os.ErrNotExist))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Setting NPM_CONFIG_USERCONFIG, API_TOKEN, ASSETS_URL, FLAG from service bindings"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Linking ~/.yarnrc.yml to its service binding"))
+		})
+
+		context("when the home directory already holds the rc file", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(homeDir, ".yarnrc.yml"), []byte("enableTelemetry: false\n"), 0600)).To(Succeed())
+			})
+
+			it("returns an error and leaves the file alone", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError(fmt.Sprintf("cannot link service binding to %s: the file already exists", filepath.Join(homeDir, ".yarnrc.yml"))))
+				Expect(filepath.Join(homeDir, ".yarnrc.yml")).To(BeARegularFile())
+			})
+		})
+
+		it("masks the binding values in the script output", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Platform: packit.Platform{Path: "some-platform-path"},
+				Layers:   packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("using [REDACTED] and [REDACTED]"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("failed with [REDACTED] after 1 attempt"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("npm-secret"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("yarn-secret"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("generic-secret"))
+		})
+	})
+
+	context("when the environment holds secrets", func() {
+		it.Before(func() {
+			t.Setenv("DEPLOY_TOKEN", "inherited-token")
+			t.Setenv("DATABASE_DSN", "postgres://user:pass@db")
+			t.Setenv("SHORT_TOKEN", "abc")
+			t.Setenv("DB_PASSWD", "hunter22")
+			t.Setenv("APIKEY", "abcdef")
+			t.Setenv("GIT_AUTHOR_NAME", "Jane Doe")
+			t.Setenv("SSH_AUTH_SOCK", "/tmp/ssh-agent.sock")
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				RedactPatterns: []string{"*_DSN"},
+				ScriptEnv: map[string]string{
+					"BUILD_SIGNING_SECRET": "script-secret",
+					"BUILD_API_KEY_ID":     "abcd",
+				},
+			})
+
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				for _, chunk := range []string{"deploying with inherited-to", "ken to postgres://user:pass@db", " signed by script-secret", " (abc)\n"} {
+					_, err := fmt.Fprint(execution.Stdout, chunk)
+					Expect(err).To(Succeed())
+				}
+
+				for _, chunk := range []string{"connecting with hunter22", " using abcdef and abcd", " as Jane Doe over /tmp/ssh-agent.sock\n"} {
+					_, err := fmt.Fprint(execution.Stdout, chunk)
+					Expect(err).To(Succeed())
+				}
+
+				return nil
+			}
+		})
+
+		it("masks the values of variables matching the redact patterns", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("SIGNING_SECRET=[REDACTED]"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("API_KEY_ID=[REDACTED]"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("deploying with [REDACTED] to [REDACTED] signed by [REDACTED] (abc)"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("connecting with [REDACTED] using [REDACTED] and [REDACTED] as Jane Doe over /tmp/ssh-agent.sock"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("inherited-token"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("user:pass"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("script-secret"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("hunter22"))
+			Expect(loggerBuffer.String()).NotTo(ContainSubstring("abcdef"))
+		})
+	})
+
+	context("when a timeout is given", func() {
+		var contextExec *fakes.ContextExecutable
+
+		it.Before(func() {
+			contextExec = &fakes.ContextExecutable{}
+			managers.Register(noderunscript.NewNPM(), contextExec)
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				Timeout:        time.Minute,
+			})
+		})
+
+		it("runs the script with a deadline", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(contextExec.ExecuteCall.CallCount).To(Equal(0))
+			Expect(contextExec.ExecuteContextCall.CallCount).To(Equal(1))
+			Expect(contextExec.ExecuteContextCall.Receives.Execution.Args).To(Equal([]string{"run", "build"}))
+
+			deadline, ok := contextExec.ExecuteContextCall.Receives.Ctx.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(time.Until(deadline)).To(And(BeNumerically(">", 50*time.Second), BeNumerically("<=", time.Minute)))
+		})
+
+		context("when the script exceeds its timeout", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ScriptTimeouts: map[string]time.Duration{"BUILD": 10 * time.Millisecond},
+				})
+
+				contextExec.ExecuteContextCall.Stub = func(ctx gocontext.Context, execution pexec.Execution) error {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+			})
+
+			it("reports which script timed out and after how long", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError(noderunscript.ErrTimeout))
+				Expect(err).To(MatchError("script 'build' timed out after 10ms"))
+			})
+		})
+	})
+
+	context("when a retry policy is given", func() {
+		var failures int
+
+		it.Before(func() {
+			failures = 2
+			npmExec.ExecuteCall.Stub = func(pexec.Execution) error {
+				if failures > 0 {
+					failures--
+					return exitError(1)
+				}
+
+				return nil
+			}
+
+			// Each reading of the clock advances it by a second, so that every
+			// attempt takes one second.
+			clock = chronos.NewClock(func() time.Time {
+				timestamp = timestamp.Add(time.Second)
+				return timestamp
+			})
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				Retry: noderunscript.RetryPolicy{
+					MaxAttempts: 3,
+					Backoff:     time.Millisecond,
+				},
+			})
+		})
+
+		it("retries the script until it succeeds", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(npmExec.ExecuteCall.CallCount).To(Equal(3))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Attempt 1 of 3 failed in 1s: exit status 1"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Retrying in 1ms"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Attempt 2 of 3 failed in 1s: exit status 1"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Retrying in 2ms"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Attempt 3 of 3 succeeded in 1s"))
+		})
+
+		context("when the script keeps failing", func() {
+			it.Before(func() {
+				failures = 5
+			})
+
+			it("gives up after the maximum number of attempts", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("exit status 1"))
+
+				Expect(npmExec.ExecuteCall.CallCount).To(Equal(3))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Attempt 3 of 3 failed in 1s: exit status 1"))
+				Expect(loggerBuffer.String()).NotTo(ContainSubstring("Retrying in 4ms"))
+			})
+		})
+
+		context("when only some exit codes are retried", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					Retry: noderunscript.RetryPolicy{
+						MaxAttempts: 3,
+						ExitCodes:   []int{137},
+					},
+				})
+			})
+
+			it("does not retry other failures", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("exit status 1"))
+
+				Expect(npmExec.ExecuteCall.CallCount).To(Equal(1))
+			})
+		})
+	})
+
+	context("when several scripts fail", func() {
+		var executions []pexec.Execution
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"lint": "lintcommand",
+					"typecheck": "typecheckcommand",
+					"build": "buildcommand"
+				}
+			}`), 0600)).To(Succeed())
+
+			executions = nil
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				executions = append(executions, execution)
+
+				switch execution.Args[1] {
+				case "lint":
+					return exitError(1)
+				case "typecheck":
+					return exitError(2)
+				}
+
+				return nil
+			}
+		})
+
+		context("when continuing on error", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts:  "lint,typecheck,build",
+					ContinueOnError: true,
+				})
+			})
+
+			it("runs every script and reports all failures", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("2 script(s) failed: 'lint' (exit code 1), 'typecheck' (exit code 2)"))
+
+				var failures noderunscript.ScriptFailures
+				Expect(errors.As(err, &failures)).To(BeTrue())
+				Expect(failures).To(HaveLen(2))
+				Expect(failures[0].Name).To(Equal("lint"))
+				Expect(failures[0].Err).To(MatchError("exit status 1"))
+				Expect(failures[1].Name).To(Equal("typecheck"))
+				Expect(failures[1].Err).To(MatchError("exit status 2"))
+
+				Expect(executions).To(HaveLen(3))
+
+				Expect(loggerBuffer.String()).To(ContainSubstring("'lint' failed: exit status 1"))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Failure summary:"))
+				Expect(loggerBuffer.String()).To(MatchRegexp(`lint\s+0s\s+exit code 1`))
+				Expect(loggerBuffer.String()).To(MatchRegexp(`typecheck\s+0s\s+exit code 2`))
+			})
+		})
+
+		context("when the failing scripts only warn", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "lint,typecheck,build",
+					WarnOnly:       []string{"lint", "typecheck"},
+				})
+			})
+
+			it("logs the failures without failing the build", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(executions).To(HaveLen(3))
+
+				Expect(loggerBuffer.String()).To(ContainSubstring("Warning: 'lint' failed: exit status 1"))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Warning: 'typecheck' failed: exit status 2"))
+				Expect(loggerBuffer.String()).To(MatchRegexp(`lint\s+0s\s+exit code 1 \(warn only\)`))
+			})
+		})
+
+		context("when not continuing on error", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "lint,typecheck,build",
+					WarnOnly:       []string{"lint"},
+				})
+			})
+
+			it("stops at the first failure that is not warn only", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("exit status 2"))
+
+				Expect(executions).To(HaveLen(2))
+			})
+		})
+	})
+
+	context("when running scripts in parallel", func() {
+		var (
+			m       sync.Mutex
+			running int
+			peak    int
+		)
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"lint": "lintcommand",
+					"typecheck": "typecheckcommand",
+					"build": "buildcommand",
+					"test": "testcommand"
+				}
+			}`), 0600)).To(Succeed())
+
+			running, peak = 0, 0
+			managers.Register(noderunscript.NewNPM(), contextExecutableFunc(func(ctx gocontext.Context, execution pexec.Execution) error {
+				m.Lock()
+				running++
+				peak = max(peak, running)
+				m.Unlock()
+
+				defer func() {
+					m.Lock()
+					running--
+					m.Unlock()
+				}()
+
+				fmt.Fprintf(execution.Stdout, "output of %s\n", execution.Args[1])
+				time.Sleep(20 * time.Millisecond)
+
+				return nil
+			}))
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "lint,typecheck,build,test",
+				Parallel:       true,
+				Concurrency:    2,
+			})
+		})
+
+		it("runs up to the given number of scripts at a time", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(peak).To(Equal(2))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("[lint     ] Running 'npm run lint'"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("[typecheck] output of typecheck"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("[test     ] output of test"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Script timings:"))
+			Expect(loggerBuffer.String()).To(MatchRegexp(`build\s+0s\s+succeeded`))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Completed in"))
+		})
+
+		context("when a script fails", func() {
+			it.Before(func() {
+				managers.Register(noderunscript.NewNPM(), contextExecutableFunc(func(ctx gocontext.Context, execution pexec.Execution) error {
+					if execution.Args[1] == "lint" {
+						return exitError(1)
+					}
+
+					<-ctx.Done()
+					return ctx.Err()
+				}))
+
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "lint,typecheck,build,test",
+					Parallel:       true,
+					Concurrency:    4,
+				})
+			})
+
+			it("cancels the other scripts", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("exit status 1"))
+
+				Expect(loggerBuffer.String()).To(MatchRegexp(`lint\s+0s\s+failed`))
+				Expect(loggerBuffer.String()).To(MatchRegexp(`typecheck\s+0s\s+cancelled`))
+				Expect(loggerBuffer.String()).To(MatchRegexp(`build\s+0s\s+cancelled`))
+				Expect(loggerBuffer.String()).To(MatchRegexp(`test\s+0s\s+cancelled`))
+			})
+		})
+	})
+
+	context("when dependencies between scripts are declared", func() {
+		var (
+			m      sync.Mutex
+			events []string
+		)
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"codegen": "codegencommand",
+					"build:js": "buildjscommand",
+					"build:css": "buildcsscommand"
+				},
+				"paketo": {
+					"dependsOn": {
+						"build:js": ["codegen"],
+						"build:css": ["codegen"]
+					}
+				}
+			}`), 0600)).To(Succeed())
+
+			events = nil
+			managers.Register(noderunscript.NewNPM(), contextExecutableFunc(func(ctx gocontext.Context, execution pexec.Execution) error {
+				m.Lock()
+				events = append(events, "start "+execution.Args[1])
+				m.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				m.Lock()
+				events = append(events, "end "+execution.Args[1])
+				m.Unlock()
+
+				if execution.Args[1] == "codegen" && strings.Contains(strings.Join(execution.Env, " "), "FAIL_CODEGEN=true") {
+					return exitError(1)
+				}
+
+				return nil
+			}))
+
+			logger = logger.WithLevel("DEBUG")
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build:js,build:css",
+				Parallel:       true,
+				Concurrency:    2,
+			})
+		})
+
+		it("runs each script once its dependencies have finished", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(events).To(HaveLen(6))
+			Expect(events[:2]).To(Equal([]string{"start codegen", "end codegen"}))
+			Expect(events[2:4]).To(ConsistOf("start build:js", "start build:css"))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Script dependency graph:"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("build:js -> codegen"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("build:css -> codegen"))
+		})
+
+		context("when a dependency fails", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts:  "build:js,build:css",
+					ScriptEnv:       map[string]string{"codegen_FAIL_CODEGEN": "true"},
+					ContinueOnError: true,
+				})
+			})
+
+			it("does not run the scripts that depend on it", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("1 script(s) failed: 'codegen' (exit code 1)"))
+
+				Expect(events).To(Equal([]string{"start codegen", "end codegen"}))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Skipping 'build:js': dependency 'codegen' failed"))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Skipping 'build:css': dependency 'codegen' failed"))
+			})
+		})
+	})
+
+	context("when running the scripts of workspace packages", func() {
+		var executions []pexec.Execution
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"name": "monorepo",
+				"workspaces": ["packages/*"]
+			}`), 0600)).To(Succeed())
+
+			for dir, content := range map[string]string{
+				"packages/ui":  `{"name": "@acme/ui", "scripts": {"build": "tsc"}}`,
+				"packages/web": `{"name": "@acme/web", "scripts": {"build": "next build"}, "dependencies": {"@acme/ui": "*"}}`,
+			} {
+				Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, dir, "package.json"), []byte(content), 0600)).To(Succeed())
+			}
+
+			executions = nil
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				executions = append(executions, execution)
+				return nil
+			}
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				Workspaces:     true,
+			})
+		})
+
+		it("runs the scripts in each package in dependency order", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(executions).To(HaveLen(2))
+			Expect(executions[0].Args).To(Equal([]string{"run", "build"}))
+			Expect(executions[0].Dir).To(Equal(filepath.Join(workingDir, "packages", "ui")))
+			Expect(executions[1].Args).To(Equal([]string{"run", "build"}))
+			Expect(executions[1].Dir).To(Equal(filepath.Join(workingDir, "packages", "web")))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Running 'npm run build' in packages/ui"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Running 'npm run build' in packages/web"))
+		})
+	})
+
+	context("when several project paths are given", func() {
+		var executions []pexec.Execution
+
+		it.Before(func() {
+			for dir, content := range map[string]string{
+				"frontend": `{"scripts": {"build": "vite build"}}`,
+				"bff":      `{"scripts": {"build": "tsc"}}`,
+			} {
+				Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, dir, "package.json"), []byte(content), 0600)).To(Succeed())
+			}
+
+			executions = nil
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				executions = append(executions, execution)
+				if execution.Dir == filepath.Join(workingDir, "bff") {
+					return exitError(2)
+				}
+
+				return nil
+			}
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts:  "build",
+				ProjectPaths:    []string{"frontend", "bff"},
+				ContinueOnError: true,
+			})
+		})
+
+		it("runs the scripts of each project and names the project that failed", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).To(MatchError("1 script(s) failed: 'bff: build' (exit code 2)"))
+
+			Expect(executions).To(HaveLen(2))
+			Expect(executions[0].Dir).To(Equal(filepath.Join(workingDir, "frontend")))
+			Expect(executions[1].Dir).To(Equal(filepath.Join(workingDir, "bff")))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Executing build process for frontend"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Executing build process for bff"))
+			Expect(loggerBuffer.String()).To(MatchRegexp(`bff: build\s+0s\s+exit code 2`))
+		})
+
+		context("when a project fails without continuing on error", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ProjectPaths:   []string{"bff", "frontend"},
+				})
+			})
+
+			it("names the project in the error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("project bff: exit status 2"))
+				Expect(executions).To(HaveLen(1))
+			})
+		})
+	})
+
+	context("when scripts declare their cached outputs", func() {
+		var (
+			builds       int
+			buildContext packit.BuildContext
+			persist      func(result packit.BuildResult)
+		)
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+				"cache": {"build": {"inputs": ["src"], "outputs": ["dist"]}}
+			}`), 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(workingDir, "src"), os.ModePerm)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "src", "index.js"), []byte("console.log('hello')"), 0600)).To(Succeed())
+
+			builds = 0
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				if execution.Args[0] == "--version" {
+					fmt.Fprintln(execution.Stdout, "10.2.0")
+					return nil
+				}
+
+				builds++
+				Expect(os.MkdirAll(filepath.Join(execution.Dir, "dist"), os.ModePerm)).To(Succeed())
+				return os.WriteFile(filepath.Join(execution.Dir, "dist", "index.js"), []byte("built"), 0600)
+			}
+
+			buildContext = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			}
+
+			// persist stores the layer metadata the way the lifecycle does
+			// between builds.
+			persist = func(result packit.BuildResult) {
+				file, err := os.Create(filepath.Join(layersDir, noderunscript.OutputCacheLayer+".toml"))
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				Expect(toml.NewEncoder(file).Encode(map[string]interface{}{"metadata": result.Layers[0].Metadata})).To(Succeed())
+				Expect(os.RemoveAll(filepath.Join(workingDir, "dist"))).To(Succeed())
+			}
+		})
+
+		it("caches the outputs in a cache layer and restores them while the inputs are unchanged", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builds).To(Equal(1))
+
+			Expect(result.Layers).To(HaveLen(1))
+			Expect(result.Layers[0].Name).To(Equal(noderunscript.OutputCacheLayer))
+			Expect(result.Layers[0].Cache).To(BeTrue())
+			Expect(result.Layers[0].Build).To(BeFalse())
+			Expect(result.Layers[0].Launch).To(BeFalse())
+			Expect(result.Layers[0].Metadata).To(HaveKey("build"))
+			persist(result)
+
+			_, err = build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builds).To(Equal(1))
+			Expect(filepath.Join(workingDir, "dist", "index.js")).To(BeARegularFile())
+			Expect(loggerBuffer.String()).To(ContainSubstring("Restored dist from cache, skipping 'build'"))
+		})
+
+		context("when an input changes", func() {
+			it("runs the script again", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				persist(result)
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "src", "index.js"), []byte("console.log('goodbye')"), 0600)).To(Succeed())
+
+				result, err = build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(builds).To(Equal(2))
+				Expect(loggerBuffer.String()).NotTo(ContainSubstring("Restored dist from cache"))
+				Expect(result.Layers[0].Metadata).To(HaveKey("build"))
+			})
+		})
+
+		context("when a dotenv file changes", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, ".env"), []byte("API_URL=https://one\n"), 0600)).To(Succeed())
+
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					DotenvFiles:    []string{".env"},
+				})
+			})
+
+			it("runs the script again", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				persist(result)
+
+				Expect(os.WriteFile(filepath.Join(workingDir, ".env"), []byte("API_URL=https://two\n"), 0600)).To(Succeed())
+
+				_, err = build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(builds).To(Equal(2))
+				Expect(loggerBuffer.String()).NotTo(ContainSubstring("Restored dist from cache"))
+			})
+		})
+
+		context("when the version of the package manager changes", func() {
+			it("runs the script again", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				persist(result)
+
+				stub := npmExec.ExecuteCall.Stub
+				npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					if execution.Args[0] == "--version" {
+						fmt.Fprintln(execution.Stdout, "11.0.0")
+						return nil
+					}
+
+					return stub(execution)
+				}
+
+				_, err = build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(builds).To(Equal(2))
+			})
+		})
+
+		context("when a rebuild is forced", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ForceRebuild:   true,
+				})
+			})
+
+			it("runs the script and caches its outputs again", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				persist(result)
+
+				result, err = build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(builds).To(Equal(2))
+				Expect(result.Layers[0].Metadata).To(HaveKey("build"))
+			})
+		})
+
+		context("when the script does not create its outputs", func() {
+			it.Before(func() {
+				npmExec.ExecuteCall.Stub = nil
+			})
+
+			it("does not cache anything", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers[0].Metadata).To(BeEmpty())
+				Expect(loggerBuffer.String()).To(ContainSubstring("Not caching the outputs of 'build': dist was not created"))
+			})
+		})
+	})
+
+	context("when tools keep caches between builds", func() {
+		var (
+			buildContext packit.BuildContext
+			found        []string
+			persist      func(result packit.BuildResult)
+		)
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {"build": "next build"},
+				"devDependencies": {"next": "14.2.0"}
+			}`), 0600)).To(Succeed())
+
+			found = nil
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				for _, dir := range []string{"node_modules/.cache/babel", ".next/cache/webpack", ".turbo"} {
+					if _, err := os.Stat(filepath.Join(execution.Dir, dir, "entry")); err == nil {
+						found = append(found, dir)
+					}
+
+					Expect(os.MkdirAll(filepath.Join(execution.Dir, dir), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(execution.Dir, dir, "entry"), []byte("0123456789"), 0600)).To(Succeed())
+				}
+
+				return nil
+			}
+
+			buildContext = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			}
+
+			// persist stores the layer metadata the way the lifecycle does
+			// between builds, and starts the next build from a fresh source.
+			persist = func(result packit.BuildResult) {
+				file, err := os.Create(filepath.Join(layersDir, noderunscript.ToolCacheLayer+".toml"))
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				Expect(toml.NewEncoder(file).Encode(map[string]interface{}{"metadata": result.Layers[0].Metadata})).To(Succeed())
+				Expect(os.RemoveAll(filepath.Join(workingDir, "node_modules"))).To(Succeed())
+				Expect(os.RemoveAll(filepath.Join(workingDir, ".next"))).To(Succeed())
+				Expect(os.RemoveAll(filepath.Join(workingDir, ".turbo"))).To(Succeed())
+			}
+		})
+
+		it("saves the caches of the detected tools and restores them before the next build", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(1))
+			Expect(result.Layers[0].Name).To(Equal(noderunscript.ToolCacheLayer))
+			Expect(result.Layers[0].Cache).To(BeTrue())
+			Expect(result.Layers[0].Launch).To(BeFalse())
+			Expect(result.Layers[0].Metadata).To(HaveLen(2))
+			Expect(result.Layers[0].Metadata).To(HaveKey("node_modules/.cache"))
+			Expect(result.Layers[0].Metadata).To(HaveKey(".next/cache"))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Saved tool caches: node_modules/.cache (10 B), .next/cache (10 B)"))
+			persist(result)
+
+			_, err = build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(Equal([]string{"node_modules/.cache/babel", ".next/cache/webpack"}))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Restored tool caches: .next/cache, node_modules/.cache"))
+		})
+
+		context("when cache directories are configured", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ToolCaches:     []string{".turbo"},
+				})
+			})
+
+			it("saves them too", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers[0].Metadata).To(HaveLen(3))
+				Expect(result.Layers[0].Metadata).To(HaveKey(".turbo"))
+			})
+		})
+
+		context("when the caches exceed the limit", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ToolCacheLimit: 15,
+				})
+			})
+
+			it("saves only what fits", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers[0].Metadata).To(HaveLen(1))
+				Expect(result.Layers[0].Metadata).To(HaveKey("node_modules/.cache"))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Not caching .next/cache: it would exceed the tool cache limit of 15 B"))
+			})
+
+			it("evicts the caches used least recently", func() {
+				Expect(os.WriteFile(filepath.Join(layersDir, noderunscript.ToolCacheLayer+".toml"), []byte(`
+					[metadata."old-app/node_modules/.cache"]
+					project = "old-app"
+					path = "node_modules/.cache"
+					size = 10
+					used = "2020-01-01T00:00:00Z"
+				`), 0600)).To(Succeed())
+
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"scripts": {"build": "webpack"}
+				}`), 0600)).To(Succeed())
+
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers[0].Metadata).To(HaveLen(1))
+				Expect(result.Layers[0].Metadata).To(HaveKey("node_modules/.cache"))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Evicting old-app/node_modules/.cache from the tool cache"))
+			})
+		})
+
+		context("when tool caches are disabled", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts:    "build",
+					DisableToolCaches: true,
+				})
+			})
+
+			it("contributes no layer", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Layers).To(BeEmpty())
+			})
+		})
+	})
+
+	context("when launch outputs are declared", func() {
+		var (
+			content      string
+			buildContext packit.BuildContext
+		)
+
+		it.Before(func() {
+			content = "built"
+			npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+				Expect(os.MkdirAll(filepath.Join(execution.Dir, "dist"), os.ModePerm)).To(Succeed())
+				return os.WriteFile(filepath.Join(execution.Dir, "dist", "index.js"), []byte(content), 0600)
+			}
+
+			buildContext = packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			}
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				LaunchOutputs:  []noderunscript.LaunchOutput{{Path: "dist"}},
+			})
+		})
+
+		// rebuild runs another build the way the lifecycle would, with the
+		// layer metadata of the previous build but without the contents of
+		// its launch layers.
+		rebuild := func(result packit.BuildResult) (packit.BuildResult, error) {
+			name := result.Layers[0].Name
+			file, err := os.Create(filepath.Join(layersDir, name+".toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(toml.NewEncoder(file).Encode(map[string]interface{}{"metadata": result.Layers[0].Metadata})).To(Succeed())
+			Expect(file.Close()).To(Succeed())
+
+			Expect(os.RemoveAll(filepath.Join(layersDir, name))).To(Succeed())
+			Expect(os.RemoveAll(filepath.Join(workingDir, "dist"))).To(Succeed())
+
+			return build(buildContext)
+		}
+
+		it("moves the outputs into a launch layer and links to it", func() {
+			result, err := build(buildContext)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(result.Layers).To(HaveLen(1))
+			Expect(result.Layers[0].Name).To(MatchRegexp(`^outputs-dist-[0-9a-f]{8}$`))
+			Expect(result.Layers[0].Launch).To(BeTrue())
+			Expect(result.Layers[0].Build).To(BeFalse())
+			Expect(result.Layers[0].Cache).To(BeFalse())
+			Expect(result.Layers[0].Metadata).To(HaveKeyWithValue("path", "dist"))
+			Expect(result.Layers[0].Metadata).To(HaveKey("digest"))
+
+			Expect(filepath.Join(result.Layers[0].Path, "index.js")).To(BeARegularFile())
+			link, err := os.Readlink(filepath.Join(workingDir, "dist"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal(result.Layers[0].Path))
+			Expect(loggerBuffer.String()).To(ContainSubstring("Moving dist into a launch layer"))
+		})
+
+		context("when the outputs have not changed since the previous build", func() {
+			it("reuses the previous layer", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				next, err := rebuild(result)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(next.Layers).To(HaveLen(1))
+				Expect(next.Layers[0].Launch).To(BeTrue())
+				Expect(next.Layers[0].Metadata).To(Equal(result.Layers[0].Metadata))
+				Expect(next.Layers[0].Path).NotTo(BeADirectory())
+				Expect(loggerBuffer.String()).To(ContainSubstring("Reusing the layer of dist, which has not changed"))
+			})
+		})
+
+		context("when the outputs have changed since the previous build", func() {
+			it("moves them into the layer again", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				content = "built again"
+				next, err := rebuild(result)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(next.Layers[0].Metadata["digest"]).NotTo(Equal(result.Layers[0].Metadata["digest"]))
+				Expect(filepath.Join(next.Layers[0].Path, "index.js")).To(BeARegularFile())
+			})
+		})
+
+		context("when a link path is configured", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					LaunchOutputs:  []noderunscript.LaunchOutput{{Path: "dist", Link: "public/app"}},
+				})
+			})
+
+			it("leaves the link there instead", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				link, err := os.Readlink(filepath.Join(workingDir, "public", "app"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(link).To(Equal(result.Layers[0].Path))
+				Expect(filepath.Join(workingDir, "dist")).NotTo(BeADirectory())
+			})
+		})
+
+		context("when the scripts do not create the outputs", func() {
+			it.Before(func() {
+				npmExec.ExecuteCall.Stub = nil
+			})
+
+			it("returns an error", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError("launch output dist was not created by the scripts"))
+			})
+		})
+
+		context("when an output names the project itself", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					LaunchOutputs:  []noderunscript.LaunchOutput{{Path: "."}},
+				})
+			})
+
+			it("returns an error and leaves the project alone", func() {
+				_, err := build(buildContext)
+				Expect(err).To(MatchError(`launch output "." must be a directory within the project`))
+
+				Expect(workingDir).To(BeADirectory())
+				Expect(filepath.Join(workingDir, "dist", "index.js")).To(BeARegularFile())
+			})
+		})
+
+		context("when several projects are built", func() {
+			it.Before(func() {
+				for _, dir := range []string{"frontend", "bff", "a-b", "a/b"} {
+					Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, dir, "package.json"), []byte(`{"scripts": {"build": "tsc"}}`), 0600)).To(Succeed())
+				}
+
+				npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					if execution.Dir == filepath.Join(workingDir, "bff") {
+						return nil
+					}
+
+					Expect(os.MkdirAll(filepath.Join(execution.Dir, "dist"), os.ModePerm)).To(Succeed())
+					return os.WriteFile(filepath.Join(execution.Dir, "dist", "index.js"), []byte(content), 0600)
+				}
+
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ProjectPaths:   []string{"frontend", "bff"},
+					LaunchOutputs:  []noderunscript.LaunchOutput{{Path: "dist"}},
+				})
+			})
+
+			it("skips the outputs a project did not create", func() {
+				result, err := build(buildContext)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(result.Layers).To(HaveLen(1))
+				Expect(result.Layers[0].Name).To(MatchRegexp(`^outputs-frontend-dist-[0-9a-f]{8}$`))
+				Expect(loggerBuffer.String()).To(ContainSubstring("Skipping bff/dist, which the scripts of the project did not create"))
+			})
+
+			context("when no project creates an output", func() {
+				it.Before(func() {
+					npmExec.ExecuteCall.Stub = nil
+				})
+
+				it("returns an error", func() {
+					_, err := build(buildContext)
+					Expect(err).To(MatchError("launch output dist was not created by the scripts of any project"))
+				})
+			})
+
+			context("when the project paths flatten to the same name", func() {
+				it.Before(func() {
+					build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+						NodeRunScripts: "build",
+						ProjectPaths:   []string{"a-b", "a/b"},
+						LaunchOutputs:  []noderunscript.LaunchOutput{{Path: "dist"}},
+					})
+				})
+
+				it("gives their outputs separate layers", func() {
+					result, err := build(buildContext)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(result.Layers).To(HaveLen(2))
+					Expect(result.Layers[0].Name).To(HavePrefix("outputs-a-b-dist-"))
+					Expect(result.Layers[1].Name).To(HavePrefix("outputs-a-b-dist-"))
+					Expect(result.Layers[0].Name).NotTo(Equal(result.Layers[1].Name))
+				})
+			})
+		})
+	})
+
+	context("when arguments are given for a script", func() {
+		it.Before(func() {
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+				ScriptArgs: map[string][]string{
+					"BUILD": {"--mode", "staging", "--base", "/my app/"},
+				},
+			})
+		})
+
+		it("passes the arguments through to the script", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(npmExec.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"run", "build", "--", "--mode", "staging", "--base", "/my app/"}))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Running 'npm run build -- --mode staging --base '/my app/''"))
+		})
+
+		context("when using yarn", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+			})
+
+			it("passes the arguments through to the script", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(yarnExec.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"run", "build", "--mode", "staging", "--base", "/my app/"}))
+			})
+		})
+	})
+
+	context("when an optional script is missing", func() {
+		it.Before(func() {
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build,?postbuild-assets",
+			})
+		})
+
+		it("skips the script", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(npmExec.ExecuteCall.CallCount).To(Equal(1))
+			Expect(npmExec.ExecuteCall.Receives.Execution.Args).To(Equal([]string{"run", "build"}))
+
+			Expect(loggerBuffer.String()).To(ContainSubstring("Skipping 'postbuild-assets': not found in package.json"))
+		})
+	})
+
+	context("when there is a custom project path set", func() {
+		it.Before(func() {
+			var err error
+			projectPath, err = os.MkdirTemp(workingDir, "custom-project-path")
+			Expect(err).NotTo(HaveOccurred())
+			base := path.Base(projectPath)
+			t.Setenv("BP_NODE_PROJECT_PATH", base)
+
+			customPath := filepath.Base(projectPath)
+
+			Expect(os.WriteFile(filepath.Join(workingDir, customPath, "yarn.lock"), nil, 0600)).To(Succeed())
+			Expect(fs.Move(filepath.Join(workingDir, "package.json"), filepath.Join(workingDir, customPath, "package.json"))).To(Succeed())
+
+			build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+				NodeRunScripts: "build",
+			})
+		})
+
+		it("works and runs the correct commands", func() {
+			_, err := build(packit.BuildContext{
+				WorkingDir: workingDir,
+				CNBPath:    cnbDir,
+				Stack:      "some-stack",
+				BuildpackInfo: packit.BuildpackInfo{
+					Name:    "Some Buildpack",
+					Version: "some-version",
+				},
+				Plan: packit.BuildpackPlan{
+					Entries: []packit.BuildpackPlanEntry{},
+				},
+				Layers: packit.Layers{Path: layersDir},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(yarnExec.ExecuteCall.CallCount).To(Equal(1))
+			Expect(yarnExec.ExecuteCall.Receives.Execution.Args).To(
+				Equal([]string{"run", "build"}))
+			Expect(yarnExec.ExecuteCall.Receives.Execution.Dir).To(Equal(projectPath))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when finding the scripts to run fails", func() {
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(workingDir, "package.json"))).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to find scripts to run")))
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+			})
+		})
+
+		context("when a dotenv file is malformed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, ".env"), []byte("API_URL=https://example.com\nGREETING=\"hello\n"), 0600)).To(Succeed())
+
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					DotenvFiles:    []string{".env"},
+				})
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("failed to load dotenv files: failed to parse .env: line 2: unterminated \" quote"))
+			})
+		})
+
+		context("when the service bindings cannot be resolved", func() {
+			it.Before(func() {
+				bindingResolver.ResolveCall.Returns.Error = errors.New("some binding error")
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Platform: packit.Platform{Path: "some-platform-path"},
+					Layers:   packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("failed to resolve npmrc service binding: some binding error"))
+			})
+		})
+
+		context("when there is more than one npmrc service binding", func() {
+			it.Before(func() {
+				bindingResolver.ResolveCall.Returns.BindingSlice = []servicebindings.Binding{
+					{Name: "first", Type: "npmrc"},
+					{Name: "second", Type: "npmrc"},
+				}
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Platform: packit.Platform{Path: "some-platform-path"},
+					Layers:   packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError(`found more than one service binding of type "npmrc"`))
+			})
+		})
+
+		context("when the npmrc service binding has no .npmrc entry", func() {
+			it.Before(func() {
+				bindingResolver.ResolveCall.Stub = func(typ, provider, platformDir string) ([]servicebindings.Binding, error) {
+					if typ != "npmrc" {
+						return nil, nil
+					}
+
+					return []servicebindings.Binding{{Name: "some-npmrc", Type: "npmrc"}}, nil
+				}
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Platform: packit.Platform{Path: "some-platform-path"},
+					Layers:   packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError(`service binding "some-npmrc" of type "npmrc" does not contain a .npmrc entry`))
+			})
+		})
+
+		context("when a timeout is given for an executable that cannot be cancelled", func() {
+			it.Before(func() {
+				build = noderunscript.Build(managers, bindingResolver, clock, logger, noderunscript.Environment{
+					NodeRunScripts: "build",
+					Timeout:        time.Minute,
+				})
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("cannot apply the timeout of script 'build': its executable does not support cancellation"))
+			})
+		})
+
+		context("when the package manager environment cannot be determined", func() {
+			it.Before(func() {
+				customManager := &fakes.PackageManager{}
+				customManager.NameCall.Returns.String = "custom"
+				customManager.DetectCall.Returns.Bool = true
+				customManager.EnvCall.Returns.Error = errors.New("some env error")
+
+				managers.Register(customManager, &fakes.Executable{})
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("failed to determine custom environment: some env error"))
+			})
+		})
+
+		context("when the script getting run has an error", func() {
+			it.Before(func() {
+				npmExec.ExecuteCall.Stub = func(execution pexec.Execution) error {
+					_, err := fmt.Fprintln(execution.Stdout, "some stdout output")
+					Expect(err).To(Succeed())
+					_, err = fmt.Fprintln(execution.Stderr, "some stderr output")
+					Expect(err).To(Succeed())
+
+					return fmt.Errorf("some execute error")
+				}
+			})
+
+			it("returns an error", func() {
+				_, err := build(packit.BuildContext{
+					WorkingDir: workingDir,
+					CNBPath:    cnbDir,
+					Stack:      "some-stack",
+					BuildpackInfo: packit.BuildpackInfo{
+						Name:    "Some Buildpack",
+						Version: "some-version",
+					},
+					Plan: packit.BuildpackPlan{
+						Entries: []packit.BuildpackPlanEntry{},
+					},
+					Layers: packit.Layers{Path: layersDir},
+				})
+				Expect(err).To(MatchError("some execute error"))
+
+				Expect(loggerBuffer.String()).To(ContainSubstring("some stdout output"))
+				Expect(loggerBuffer.String()).To(ContainSubstring("some stderr output"))
+			})
+		})
+	})
+}
+
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func (e exitError) ExitCode() int {
+	return int(e)
+}
+
+// contextExecutableFunc adapts a function to a ContextExecutable. Unlike the
+// fakes, which hold a lock while running their stub, it can be called
+// concurrently.
+type contextExecutableFunc func(gocontext.Context, pexec.Execution) error
+
+func (f contextExecutableFunc) Execute(execution pexec.Execution) error {
+	return f(gocontext.Background(), execution)
+}
+
+func (f contextExecutableFunc) ExecuteContext(ctx gocontext.Context, execution pexec.Execution) error {
+	return f(ctx, execution)
 }
@@ -0,0 +1,272 @@
+package noderunscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/paketo-buildpacks/libnodejs"
+	"github.com/paketo-buildpacks/packit/v2"
+	packitfs "github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+)
+
+// OutputCacheLayer is the name of the cache layer holding the outputs of
+// scripts.
+const OutputCacheLayer = "script-outputs"
+
+// lockfiles are the lockfiles whose content is part of the fingerprint of a
+// script.
+var lockfiles = []string{"package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml", "bun.lock", "bun.lockb"}
+
+// outputCache stores the outputs of scripts in a cache layer, along with a
+// fingerprint of their inputs, so that scripts whose inputs did not change
+// can be skipped.
+type outputCache struct {
+	layer packit.Layer
+	force bool
+
+	m    sync.Mutex
+	used map[string]bool
+}
+
+// newOutputCache returns the cache held by the OutputCacheLayer. When forced,
+// every script is run and its outputs cached again.
+func newOutputCache(layers packit.Layers, force bool) (*outputCache, error) {
+	layer, err := layers.Get(OutputCacheLayer)
+	if err != nil {
+		return nil, err
+	}
+
+	layer.Cache = true
+	if layer.Metadata == nil {
+		layer.Metadata = map[string]interface{}{}
+	}
+
+	return &outputCache{
+		layer: layer,
+		force: force,
+		used:  map[string]bool{},
+	}, nil
+}
+
+// entryDir returns the directory of the layer holding the outputs cached for
+// the key.
+func (c *outputCache) entryDir(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.layer.Path, hex.EncodeToString(sum[:8]))
+}
+
+// restore copies the cached outputs of the key into the directory of the
+// script if they were cached with the given fingerprint. It reports whether
+// they were restored.
+func (c *outputCache) restore(key, fingerprint, dir string, outputs []string) (bool, error) {
+	c.m.Lock()
+	c.used[key] = true
+	cached, _ := c.layer.Metadata[key].(string)
+	c.m.Unlock()
+
+	if c.force || cached != fingerprint {
+		return false, nil
+	}
+
+	entry := c.entryDir(key)
+	for _, output := range outputs {
+		if _, err := os.Lstat(filepath.Join(entry, output)); err != nil {
+			return false, nil
+		}
+	}
+
+	for _, output := range outputs {
+		destination := filepath.Join(dir, output)
+		if err := os.RemoveAll(destination); err != nil {
+			return false, fmt.Errorf("failed to restore %s: %w", output, err)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+			return false, fmt.Errorf("failed to restore %s: %w", output, err)
+		}
+
+		if err := packitfs.Copy(filepath.Join(entry, output), destination); err != nil {
+			return false, fmt.Errorf("failed to restore %s: %w", output, err)
+		}
+	}
+
+	return true, nil
+}
+
+// save caches the outputs of the key with the given fingerprint. If an
+// output does not exist, nothing is cached and the missing output is
+// returned.
+func (c *outputCache) save(key, fingerprint, dir string, outputs []string) (string, error) {
+	entry := c.entryDir(key)
+	if err := os.RemoveAll(entry); err != nil {
+		return "", fmt.Errorf("failed to cache outputs: %w", err)
+	}
+
+	c.m.Lock()
+	delete(c.layer.Metadata, key)
+	c.m.Unlock()
+
+	for _, output := range outputs {
+		source := filepath.Join(dir, output)
+		if _, err := os.Lstat(source); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return output, os.RemoveAll(entry)
+			}
+
+			return "", fmt.Errorf("failed to cache %s: %w", output, err)
+		}
+
+		destination := filepath.Join(entry, output)
+		if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+			return "", fmt.Errorf("failed to cache %s: %w", output, err)
+		}
+
+		if err := packitfs.Copy(source, destination); err != nil {
+			return "", fmt.Errorf("failed to cache %s: %w", output, err)
+		}
+	}
+
+	c.m.Lock()
+	c.layer.Metadata[key] = fingerprint
+	c.m.Unlock()
+
+	return "", nil
+}
+
+// finish removes the outputs of scripts that were not run in this build and
+// returns the layer.
+func (c *outputCache) finish() (packit.Layer, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, key := range slices.Sorted(maps.Keys(c.layer.Metadata)) {
+		if c.used[key] {
+			continue
+		}
+
+		if err := os.RemoveAll(c.entryDir(key)); err != nil {
+			return packit.Layer{}, fmt.Errorf("failed to remove stale outputs: %w", err)
+		}
+		delete(c.layer.Metadata, key)
+	}
+
+	return c.layer, nil
+}
+
+// scriptFingerprint hashes everything the outputs of a script depend on: the
+// script itself, the environment it runs with on top of the inherited one,
+// the package.json scripts and lockfile, the files matching its inputs and
+// the versions of the tools it runs with.
+func scriptFingerprint(script Script, env []string, dir, projectDir, tools string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "script %s %q\n", script.Name, script.Args)
+	fmt.Fprintf(hash, "env %q\n", slices.Sorted(slices.Values(env)))
+	fmt.Fprintf(hash, "tools %s\n", tools)
+
+	packageJSON, err := libnodejs.ParsePackageJSON(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(packageJSON.AllScripts)) {
+		fmt.Fprintf(hash, "package.json %s %q\n", name, packageJSON.AllScripts[name])
+	}
+
+	// Workspace packages share the lockfile of the project.
+	for _, lockfileDir := range slices.Compact([]string{projectDir, dir}) {
+		for _, name := range lockfiles {
+			if err := hashFile(hash, lockfileDir, name); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if path != dir && (entry.Name() == "node_modules" || entry.Name() == ".git") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// The outputs are never inputs, or the fingerprint would change
+		// with every run.
+		for _, output := range script.Outputs {
+			if matchGlob(output, rel) || matchGlob(output+"/**", rel) {
+				return nil
+			}
+		}
+
+		for _, input := range script.Inputs {
+			if matchGlob(input, rel) || matchGlob(input+"/**", rel) {
+				return hashFile(hash, dir, rel)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash inputs: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashFile writes the name and content of the file to the hash.
+func hashFile(hash io.Writer, dir, name string) error {
+	file, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(hash, "file %s\n", name)
+	_, err = io.Copy(hash, file)
+
+	return err
+}
+
+// toolVersions describes the package manager and Node.js that scripts run
+// with. The package manager reports its version, while Node.js is identified
+// by the size and modification time of its executable.
+func toolVersions(executable Executable, packageManager PackageManager, dir string) string {
+	var version bytes.Buffer
+	_ = executable.Execute(pexec.Execution{
+		Dir:    dir,
+		Args:   []string{"--version"},
+		Stdout: &version,
+		Stderr: io.Discard,
+	})
+
+	tools := fmt.Sprintf("%s %s", packageManager.Name(), strings.TrimSpace(version.String()))
+
+	if node, err := lookPath("node", nil); err == nil {
+		if info, err := os.Stat(node); err == nil {
+			tools += fmt.Sprintf(", node %s %d %d", node, info.Size(), info.ModTime().Unix())
+		}
+	}
+
+	return tools
+}
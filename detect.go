@@ -2,51 +2,88 @@ package noderunscript
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"slices"
 
-	"github.com/paketo-buildpacks/libnodejs"
 	"github.com/paketo-buildpacks/packit/v2"
 )
 
 type BuildPlanMetadata struct {
-	Build bool `toml:"build"`
+	Version       string `toml:"version,omitempty"`
+	VersionSource string `toml:"version-source,omitempty"`
+	Build         bool   `toml:"build"`
 }
 
-func Detect(env Environment) packit.DetectFunc {
+func Detect(managers *PackageManagerRegistry, env Environment) packit.DetectFunc {
 	return func(context packit.DetectContext) (packit.DetectResult, error) {
 		if env.NodeRunScripts == "" {
 			return packit.DetectResult{}, packit.Fail.WithMessage(`script running has been deactivated: BP_NODE_RUN_SCRIPTS=""`)
 		}
 
-		projectDir, err := libnodejs.FindProjectPath(context.WorkingDir)
+		projects, err := findProjects(context.WorkingDir, env)
 		if err != nil {
 			return packit.DetectResult{}, err
 		}
-		_, packageManager, err := ScriptsToRun(projectDir, env.NodeRunScripts)
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				return packit.DetectResult{}, packit.Fail.WithMessage("no package.json file present")
+
+		requirements := []packit.BuildPlanRequirement{
+			{
+				Name:     "node",
+				Metadata: BuildPlanMetadata{Build: true},
+			},
+		}
+
+		// The requirements of every project are merged, so each of them is
+		// only required once.
+		for _, project := range projects {
+			_, packageManager, version, err := ScriptsToRun(project.Dir, env, managers)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return packit.DetectResult{}, packit.Fail.WithMessage("%s", project.wrap(errors.New("no package.json file present")))
+				}
+
+				if errors.Is(err, ErrPackageManagerMismatch) {
+					return packit.DetectResult{}, packit.Fail.WithMessage("%s", project.wrap(err))
+				}
+
+				return packit.DetectResult{}, project.wrap(err)
 			}
 
-			return packit.DetectResult{}, err
+			names, err := packageManager.Requirements(project.Dir, version)
+			if err != nil {
+				return packit.DetectResult{}, project.wrap(err)
+			}
+
+			for _, name := range names {
+				metadata := BuildPlanMetadata{Build: true}
+				if name == packageManager.Name() && version != "" {
+					metadata.Version = version
+					metadata.VersionSource = "package.json"
+				}
+
+				index := slices.IndexFunc(requirements, func(r packit.BuildPlanRequirement) bool { return r.Name == name })
+				if index < 0 {
+					requirements = append(requirements, packit.BuildPlanRequirement{
+						Name:     name,
+						Metadata: metadata,
+					})
+					continue
+				}
+
+				required := requirements[index].Metadata.(BuildPlanMetadata)
+				switch {
+				case metadata.Version == "" || metadata.Version == required.Version:
+				case required.Version == "":
+					requirements[index].Metadata = metadata
+				default:
+					return packit.DetectResult{}, project.wrap(fmt.Errorf("requires %s %s, but another project requires %s", name, metadata.Version, required.Version))
+				}
+			}
 		}
 
 		return packit.DetectResult{
 			Plan: packit.BuildPlan{
-				Requires: []packit.BuildPlanRequirement{
-					{
-						Name:     "node",
-						Metadata: BuildPlanMetadata{Build: true},
-					},
-					{
-						Name:     packageManager,
-						Metadata: BuildPlanMetadata{Build: true},
-					},
-					{
-						Name:     "node_modules",
-						Metadata: BuildPlanMetadata{Build: true},
-					},
-				},
+				Requires: requirements,
 			},
 		}, nil
 	}
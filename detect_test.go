@@ -1,12 +1,14 @@
 package noderunscript_test
 
 import (
+	"errors"
 	"os"
 	"path"
 	"path/filepath"
 	"testing"
 
 	noderunscript "github.com/paketo-buildpacks/node-run-script"
+	"github.com/paketo-buildpacks/node-run-script/fakes"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/fs"
 	"github.com/sclevine/spec"
@@ -19,6 +21,7 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		Expect = NewWithT(t).Expect
 
 		workingDir string
+		managers   *noderunscript.PackageManagerRegistry
 		detect     packit.DetectFunc
 	)
 
@@ -34,7 +37,12 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 			}
 		}`), 0600)).To(Succeed())
 
-		detect = noderunscript.Detect(noderunscript.Environment{
+		managers = noderunscript.NewPackageManagerRegistry(noderunscript.NewNPM(), &fakes.Executable{})
+		managers.Register(noderunscript.NewYarn(), &fakes.Executable{})
+		managers.Register(noderunscript.NewPNPM(), &fakes.Executable{})
+		managers.Register(noderunscript.NewBun(), &fakes.Executable{})
+
+		detect = noderunscript.Detect(managers, noderunscript.Environment{
 			NodeRunScripts: "build",
 		})
 	})
@@ -97,9 +105,245 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when using pnpm", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "pnpm-lock.yaml"), nil, 0600)).To(Succeed())
+		})
+
+		it("returns a plan that requires node and pnpm", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name:     "node",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "pnpm",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "node_modules",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+				},
+			}))
+		})
+	})
+
+	context("when using bun", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "bun.lock"), nil, 0600)).To(Succeed())
+		})
+
+		it("returns a plan that requires node and bun", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name:     "node",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "bun",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+				},
+			}))
+		})
+	})
+
+	context("when the package.json pins a package manager version", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"packageManager": "yarn@1.22.22",
+				"scripts": {
+					"build": "mybuildcommand --args"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("requires that version of the package manager", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name:     "node",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name: "yarn",
+						Metadata: noderunscript.BuildPlanMetadata{
+							Version:       "1.22.22",
+							VersionSource: "package.json",
+							Build:         true,
+						},
+					},
+					{
+						Name:     "node_modules",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+				},
+			}))
+		})
+	})
+
+	context("when using yarn berry", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, ".yarnrc.yml"), []byte("nodeLinker: node-modules\n"), 0600)).To(Succeed())
+		})
+
+		it("returns a plan that requires node, yarn and node_modules", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name:     "node",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "yarn",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "node_modules",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+				},
+			}))
+		})
+
+		context("when the project uses Plug'n'Play", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, ".yarnrc.yml"), []byte("nodeLinker: \"pnp\" # default\n"), 0600)).To(Succeed())
+			})
+
+			it("returns a plan that does not require node_modules", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan).To(Equal(packit.BuildPlan{
+					Requires: []packit.BuildPlanRequirement{
+						{
+							Name:     "node",
+							Metadata: noderunscript.BuildPlanMetadata{Build: true},
+						},
+						{
+							Name:     "yarn",
+							Metadata: noderunscript.BuildPlanMetadata{Build: true},
+						},
+					},
+				}))
+			})
+		})
+
+		context("when a .pnp.cjs file is present", func() {
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(workingDir, ".yarnrc.yml"))).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, ".pnp.cjs"), nil, 0600)).To(Succeed())
+			})
+
+			it("returns a plan that does not require node_modules", func() {
+				result, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Plan.Requires).To(HaveLen(2))
+				Expect(result.Plan.Requires[1].Name).To(Equal("yarn"))
+			})
+		})
+	})
+
+	context("when a custom package manager is registered", func() {
+		var customManager *fakes.PackageManager
+
+		it.Before(func() {
+			customManager = &fakes.PackageManager{}
+			customManager.NameCall.Returns.String = "custom"
+			customManager.DetectCall.Returns.Bool = true
+			customManager.RequirementsCall.Returns.StringSlice = []string{"custom", "custom_modules"}
+
+			managers.Register(customManager, &fakes.Executable{})
+		})
+
+		it("returns a plan that requires the custom package manager requirements", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name:     "node",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "custom",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "custom_modules",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+				},
+			}))
+
+			Expect(customManager.RequirementsCall.Receives.WorkingDir).To(Equal(workingDir))
+			Expect(customManager.RequirementsCall.Receives.Version).To(BeEmpty())
+		})
+	})
+
+	context("when env var $BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER is set", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+
+			detect = noderunscript.Detect(managers, noderunscript.Environment{
+				NodeRunScripts: "build",
+				PackageManager: "npm",
+			})
+		})
+
+		it("requires the requested package manager", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name:     "node",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "npm",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "node_modules",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+				},
+			}))
+		})
+	})
+
 	context("when env var $BP_NODE_RUN_SCRIPTS has spaces among commas", func() {
 		it.Before(func() {
-			detect = noderunscript.Detect(noderunscript.Environment{NodeRunScripts: "build, some-script"})
+			detect = noderunscript.Detect(managers, noderunscript.Environment{NodeRunScripts: "build, some-script"})
 		})
 
 		it("trims the whitespace and successfully detects the scripts", func() {
@@ -110,9 +354,25 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when env var $BP_NODE_RUN_SCRIPTS_IF_PRESENT is set", func() {
+		it.Before(func() {
+			detect = noderunscript.Detect(managers, noderunscript.Environment{
+				NodeRunScripts: "build,postbuild-assets",
+				IfPresent:      true,
+			})
+		})
+
+		it("detects in spite of missing scripts", func() {
+			_, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
 	context("when env var $BP_NODE_RUN_SCRIPTS is empty", func() {
 		it.Before(func() {
-			detect = noderunscript.Detect(noderunscript.Environment{NodeRunScripts: ""})
+			detect = noderunscript.Detect(managers, noderunscript.Environment{NodeRunScripts: ""})
 		})
 
 		it("fails detection", func() {
@@ -134,7 +394,7 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 			Expect(os.WriteFile(filepath.Join(workingDir, customPath, "yarn.lock"), nil, 0600)).To(Succeed())
 			Expect(fs.Move(filepath.Join(workingDir, "package.json"), filepath.Join(workingDir, customPath, "package.json"))).To(Succeed())
 
-			detect = noderunscript.Detect(noderunscript.Environment{
+			detect = noderunscript.Detect(managers, noderunscript.Environment{
 				NodeRunScripts: "build",
 			})
 		})
@@ -165,6 +425,128 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 		})
 	})
 
+	context("when several project paths are given", func() {
+		it.Before(func() {
+			for dir, content := range map[string]string{
+				"frontend": `{"packageManager": "pnpm@9.1.0", "scripts": {"build": "vite build"}}`,
+				"bff":      `{"scripts": {"build": "tsc"}}`,
+			} {
+				Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, dir, "package.json"), []byte(content), 0600)).To(Succeed())
+			}
+
+			detect = noderunscript.Detect(managers, noderunscript.Environment{
+				NodeRunScripts: "build",
+				ProjectPaths:   []string{"frontend", "bff"},
+			})
+		})
+
+		it("merges the requirements of every project", func() {
+			result, err := detect(packit.DetectContext{
+				WorkingDir: workingDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Plan).To(Equal(packit.BuildPlan{
+				Requires: []packit.BuildPlanRequirement{
+					{
+						Name:     "node",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name: "pnpm",
+						Metadata: noderunscript.BuildPlanMetadata{
+							Version:       "9.1.0",
+							VersionSource: "package.json",
+							Build:         true,
+						},
+					},
+					{
+						Name:     "node_modules",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+					{
+						Name:     "npm",
+						Metadata: noderunscript.BuildPlanMetadata{Build: true},
+					},
+				},
+			}))
+		})
+
+		context("when the projects pin different versions of a package manager", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "bff", "package.json"), []byte(`{
+					"packageManager": "pnpm@8.15.0",
+					"scripts": {"build": "tsc"}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error naming the project", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError("project bff: requires pnpm 8.15.0, but another project requires 9.1.0"))
+			})
+		})
+
+		context("when a project is missing a script", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "bff", "package.json"), []byte(`{"scripts": {}}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error naming the project", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError("project bff: could not find script(s) [build] in package.json"))
+			})
+		})
+
+		context("when a project has no package.json", func() {
+			it.Before(func() {
+				Expect(os.Remove(filepath.Join(workingDir, "bff", "package.json"))).To(Succeed())
+			})
+
+			it("fails detection naming the project", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError(packit.Fail.WithMessage("project bff: no package.json file present")))
+			})
+		})
+
+		context("when a project path does not exist", func() {
+			it.Before(func() {
+				detect = noderunscript.Detect(managers, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ProjectPaths:   []string{"frontend", "api"},
+				})
+			})
+
+			it("returns an error", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError(ContainSubstring(`could not find project path "api"`)))
+			})
+		})
+
+		context("when a project path is outside of the working directory", func() {
+			it.Before(func() {
+				detect = noderunscript.Detect(managers, noderunscript.Environment{
+					NodeRunScripts: "build",
+					ProjectPaths:   []string{"frontend", "../elsewhere"},
+				})
+			})
+
+			it("returns an error", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+				Expect(err).To(MatchError(`project path "../elsewhere" is not within the working directory`))
+			})
+		})
+	})
+
 	context("failure cases", func() {
 		context("if package.json is absent", func() {
 			it.Before(func() {
@@ -180,9 +562,29 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("if the pinned package manager does not match the lockfile", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "pnpm@9.1.0",
+					"scripts": {
+						"build": "mybuildcommand --args"
+					}
+				}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+			})
+
+			it("fails detection", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+
+				Expect(err).To(MatchError(packit.Fail.WithMessage(`package manager mismatch: package.json "packageManager" field requests pnpm@9.1.0 but detected yarn`)))
+			})
+		})
+
 		context("if any of the scripts in \"$BP_NODE_RUN_SCRIPTS\" does not exist in package.json", func() {
 			it.Before(func() {
-				detect = noderunscript.Detect(noderunscript.Environment{
+				detect = noderunscript.Detect(managers, noderunscript.Environment{
 					NodeRunScripts: "build,script1,some-script,script2,script3",
 				})
 			})
@@ -196,9 +598,88 @@ func testDetect(t *testing.T, context spec.G, it spec.S) {
 			})
 		})
 
+		context("if the script dependencies contain a cycle", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"scripts": {
+						"build": "mybuildcommand --args",
+						"codegen": "codegencommand --args"
+					},
+					"paketo": {
+						"dependsOn": {
+							"build": ["codegen"],
+							"codegen": ["build"]
+						}
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+
+				Expect(err).To(MatchError("invalid script dependencies in package.json: found a cycle: build -> codegen -> build"))
+			})
+		})
+
+		context("if a script depends on a script that does not exist in package.json", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"dependsOn": {
+						"build": ["codegen"]
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+
+				Expect(err).To(MatchError(`invalid script dependencies in node-run-script.json: script "build" depends on "codegen", which is not in package.json`))
+			})
+		})
+
+		context("if $BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER is invalid", func() {
+			it.Before(func() {
+				detect = noderunscript.Detect(managers, noderunscript.Environment{
+					NodeRunScripts: "build",
+					PackageManager: "cnpm",
+				})
+			})
+
+			it("returns an error", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+
+				Expect(err).To(MatchError(`invalid package manager "cnpm" in BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER: supported package managers are bun, npm, pnpm, yarn`))
+			})
+		})
+
+		context("if the package manager requirements cannot be determined", func() {
+			it.Before(func() {
+				customManager := &fakes.PackageManager{}
+				customManager.NameCall.Returns.String = "custom"
+				customManager.DetectCall.Returns.Bool = true
+				customManager.RequirementsCall.Returns.Error = errors.New("some requirements error")
+
+				managers.Register(customManager, &fakes.Executable{})
+			})
+
+			it("returns an error", func() {
+				_, err := detect(packit.DetectContext{
+					WorkingDir: workingDir,
+				})
+
+				Expect(err).To(MatchError("some requirements error"))
+			})
+		})
+
 		context("if $BP_NODE_PROJECT_PATH leads to a directory that doesn't exist", func() {
 			it.Before(func() {
-				detect = noderunscript.Detect(noderunscript.Environment{
+				detect = noderunscript.Detect(managers, noderunscript.Environment{
 					NodeRunScripts: "build",
 				})
 				t.Setenv("BP_NODE_PROJECT_PATH", "not_a_real_directory")
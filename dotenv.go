@@ -0,0 +1,124 @@
+package noderunscript
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadDotenvFiles reads the given dotenv files from the project directory in
+// order, with variables from later files overriding those from earlier ones.
+// Files that do not exist are skipped. It returns the variables in KEY=VALUE
+// form along with the names of the files that were loaded.
+func loadDotenvFiles(workingDir string, names []string) ([]string, []string, error) {
+	var (
+		variables []string
+		loaded    []string
+	)
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(workingDir, name))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		parsed, err := parseDotenv(string(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+
+		variables = mergeEnv(variables, parsed)
+		loaded = append(loaded, name)
+	}
+
+	return variables, loaded, nil
+}
+
+// parseDotenv parses the contents of a dotenv file. Each line holds a
+// KEY=VALUE pair, optionally preceded by "export". Values may be single
+// quoted, taken literally, or double quoted, in which case \n, \r, \t, \" and
+// \\ are unescaped. Unquoted values end at a " #" comment. Variable
+// references are not expanded.
+func parseDotenv(content string) ([]string, error) {
+	var variables []string
+	for number, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", number+1)
+		}
+
+		value, err := parseDotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+
+		variables = mergeEnv(variables, []string{key + "=" + value})
+	}
+
+	return variables, nil
+}
+
+func parseDotenvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	quote := value[0]
+	if quote != '\'' && quote != '"' {
+		if index := strings.Index(value, " #"); index >= 0 {
+			value = value[:index]
+		}
+
+		return strings.TrimSpace(value), nil
+	}
+
+	var (
+		unquoted strings.Builder
+		escaped  bool
+	)
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case escaped:
+			switch c {
+			case 'n':
+				unquoted.WriteByte('\n')
+			case 'r':
+				unquoted.WriteByte('\r')
+			case 't':
+				unquoted.WriteByte('\t')
+			case '"', '\\':
+				unquoted.WriteByte(c)
+			default:
+				unquoted.WriteByte('\\')
+				unquoted.WriteByte(c)
+			}
+			escaped = false
+		case c == '\\' && quote == '"':
+			escaped = true
+		case c == quote:
+			if rest := strings.TrimSpace(value[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", errors.New("unexpected characters after quoted value")
+			}
+
+			return unquoted.String(), nil
+		default:
+			unquoted.WriteByte(c)
+		}
+	}
+
+	return "", fmt.Errorf("unterminated %c quote", quote)
+}
@@ -0,0 +1,52 @@
+package noderunscript
+
+import (
+	"slices"
+	"strings"
+)
+
+// defaultSourceDateEpoch is 1980-01-01T00:00:00Z, the timestamp the lifecycle
+// gives to files in the image.
+const defaultSourceDateEpoch = "315532800"
+
+// defaultEnv returns the variables, in KEY=VALUE form, that give scripts a
+// non-interactive, reproducible build environment. They are set beneath any
+// other environment.
+func defaultEnv(env Environment) []string {
+	if env.DisableDefaultEnv {
+		return nil
+	}
+
+	sourceDateEpoch := env.SourceDateEpoch
+	if sourceDateEpoch == "" {
+		sourceDateEpoch = defaultSourceDateEpoch
+	}
+
+	return []string{
+		"CI=true",
+		"NODE_ENV=production",
+		"SOURCE_DATE_EPOCH=" + sourceDateEpoch,
+		"npm_config_update_notifier=false",
+	}
+}
+
+// mergeEnv returns the base environment, in KEY=VALUE form, with each of the
+// overrides applied in turn. A variable that is already present is replaced
+// in place, and new variables are appended.
+func mergeEnv(base []string, overrides ...[]string) []string {
+	merged := slices.Clone(base)
+	for _, override := range overrides {
+		for _, variable := range override {
+			key, _, _ := strings.Cut(variable, "=")
+			index := slices.IndexFunc(merged, func(v string) bool { return strings.HasPrefix(v, key+"=") })
+			if index >= 0 {
+				merged[index] = variable
+				continue
+			}
+
+			merged = append(merged, variable)
+		}
+	}
+
+	return merged
+}
@@ -1,15 +1,116 @@
 package noderunscript
 
 import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Environment struct {
 	LogLevel       string
 	NodeRunScripts string
+	PackageManager string
+	IfPresent      bool
+
+	// RunLifecycleScripts runs the pre and post lifecycle scripts of each
+	// script explicitly when the package manager, like Yarn Berry, does not
+	// run them itself.
+	RunLifecycleScripts bool
+
+	// ProjectPaths lists the directories, relative to the working directory,
+	// of the projects whose scripts are run. If empty, the project is found
+	// with libnodejs.FindProjectPath.
+	ProjectPaths []string
+
+	// ScriptArgs holds the arguments to pass to each script, keyed by the
+	// script name as it appears in BP_NODE_RUN_SCRIPT_ARGS_<SCRIPT>.
+	ScriptArgs map[string][]string
+
+	// ScriptEnv holds the environment variables to set for individual
+	// scripts, keyed by the <SCRIPT>_<VAR> suffix of
+	// BP_NODE_RUN_SCRIPT_ENV_<SCRIPT>_<VAR>.
+	ScriptEnv map[string]string
+
+	// DotenvFiles lists the dotenv files, relative to the project directory,
+	// that are loaded into the environment of every script, in order.
+	DotenvFiles []string
+
+	// DisableDefaultEnv turns off the default environment (CI, NODE_ENV,
+	// SOURCE_DATE_EPOCH and npm_config_update_notifier) given to scripts.
+	DisableDefaultEnv bool
+
+	// SourceDateEpoch overrides the SOURCE_DATE_EPOCH given to scripts as
+	// part of the default environment.
+	SourceDateEpoch string
+
+	// RedactPatterns holds environment variable name patterns, in addition
+	// to DefaultRedactPatterns, whose values are masked in the build output.
+	RedactPatterns []string
+
+	// Timeout is how long each script may run before it is terminated, unless
+	// overridden by ScriptTimeouts. Zero means no timeout.
+	Timeout time.Duration
+
+	// ScriptTimeouts holds the timeout of each script, keyed by the script
+	// name as it appears in BP_NODE_RUN_SCRIPT_TIMEOUT_<SCRIPT>.
+	ScriptTimeouts map[string]time.Duration
+
+	// GracePeriod is how long a timed out script is given to exit after
+	// SIGTERM before it is sent SIGKILL.
+	GracePeriod time.Duration
+
+	// Retry is the policy for retrying failing scripts.
+	Retry RetryPolicy
+
+	// ContinueOnError runs every script even after one fails, failing the
+	// build with a summary of all failures at the end.
+	ContinueOnError bool
+
+	// WarnOnly lists the scripts whose failure is logged but does not fail
+	// the build.
+	WarnOnly []string
+
+	// Parallel runs the scripts concurrently instead of one after the other.
+	Parallel bool
+
+	// Concurrency is the maximum number of scripts run at a time when
+	// Parallel is set. Zero means the number of CPUs.
+	Concurrency int
+
+	// Workspaces runs the scripts in every package of the workspace rather
+	// than in the project itself.
+	Workspaces bool
+
+	// WorkspaceFilter holds the package name patterns that select the
+	// workspace packages to run the scripts in. A pattern ending in "..."
+	// selects the dependencies of the matching packages too.
+	WorkspaceFilter []string
+
+	// ForceRebuild runs every script even when its outputs are cached for
+	// its current inputs.
+	ForceRebuild bool
+
+	// ToolCaches holds glob patterns, relative to the project directory,
+	// of cache directories to keep between builds in addition to those
+	// detected for known tools.
+	ToolCaches []string
+
+	// ToolCacheLimit is the total size, in bytes, of the cached tool
+	// directories. Zero means DefaultToolCacheLimit.
+	ToolCacheLimit int64
+
+	// DisableToolCaches turns off keeping tool caches between builds.
+	DisableToolCaches bool
+
+	// LaunchOutputs lists the output directories of every project that are
+	// moved into launch layers of their own.
+	LaunchOutputs []LaunchOutput
 }
 
-func LoadEnvironment(variables []string) Environment {
+func LoadEnvironment(variables []string) (Environment, error) {
 	environment := Environment{
 		LogLevel:       "INFO",
 		NodeRunScripts: "build",
@@ -23,9 +124,249 @@ func LoadEnvironment(variables []string) Environment {
 				environment.LogLevel = value
 			case "BP_NODE_RUN_SCRIPTS":
 				environment.NodeRunScripts = value
+			case "BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER":
+				environment.PackageManager = value
+			case "BP_NODE_RUN_SCRIPTS_IF_PRESENT":
+				ifPresent, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_IF_PRESENT: %w", err)
+				}
+				environment.IfPresent = ifPresent
+			case "BP_NODE_RUN_SCRIPTS_DISABLE_DEFAULT_ENV":
+				disable, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_DISABLE_DEFAULT_ENV: %w", err)
+				}
+				environment.DisableDefaultEnv = disable
+			case "BP_NODE_RUN_SCRIPTS_SOURCE_DATE_EPOCH":
+				if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_SOURCE_DATE_EPOCH: %w", err)
+				}
+				environment.SourceDateEpoch = value
+			case "BP_NODE_RUN_SCRIPTS_REDACT_PATTERNS":
+				for _, pattern := range strings.Split(value, ",") {
+					if pattern = strings.TrimSpace(pattern); pattern == "" {
+						continue
+					}
+
+					if _, err := path.Match(pattern, ""); err != nil {
+						return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_REDACT_PATTERNS: invalid pattern %q: %w", pattern, err)
+					}
+					environment.RedactPatterns = append(environment.RedactPatterns, pattern)
+				}
+			case "BP_NODE_RUN_SCRIPTS_TIMEOUT":
+				timeout, err := parseDuration(key, value)
+				if err != nil {
+					return Environment{}, err
+				}
+				environment.Timeout = timeout
+			case "BP_NODE_RUN_SCRIPTS_TIMEOUT_GRACE_PERIOD":
+				gracePeriod, err := parseDuration(key, value)
+				if err != nil {
+					return Environment{}, err
+				}
+				environment.GracePeriod = gracePeriod
+			case "BP_NODE_RUN_SCRIPTS_MAX_ATTEMPTS":
+				attempts, err := strconv.Atoi(value)
+				if err != nil || attempts < 1 {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_MAX_ATTEMPTS: %q is not a positive integer", value)
+				}
+				environment.Retry.MaxAttempts = attempts
+			case "BP_NODE_RUN_SCRIPTS_RETRY_BACKOFF":
+				backoff, err := parseDuration(key, value)
+				if err != nil {
+					return Environment{}, err
+				}
+				environment.Retry.Backoff = backoff
+			case "BP_NODE_RUN_SCRIPTS_RETRY_EXIT_CODES":
+				for _, code := range strings.Split(value, ",") {
+					if code = strings.TrimSpace(code); code == "" {
+						continue
+					}
+
+					exitCode, err := strconv.Atoi(code)
+					if err != nil {
+						return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_RETRY_EXIT_CODES: %w", err)
+					}
+					environment.Retry.ExitCodes = append(environment.Retry.ExitCodes, exitCode)
+				}
+			case "BP_NODE_RUN_SCRIPTS_CONTINUE_ON_ERROR":
+				continueOnError, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_CONTINUE_ON_ERROR: %w", err)
+				}
+				environment.ContinueOnError = continueOnError
+			case "BP_NODE_RUN_SCRIPTS_WARN_ONLY":
+				for _, name := range strings.Split(value, ",") {
+					if name = strings.TrimSpace(name); name != "" {
+						environment.WarnOnly = append(environment.WarnOnly, name)
+					}
+				}
+			case "BP_NODE_RUN_SCRIPTS_PARALLEL":
+				parallel, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_PARALLEL: %w", err)
+				}
+				environment.Parallel = parallel
+			case "BP_NODE_RUN_SCRIPTS_CONCURRENCY":
+				concurrency, err := strconv.Atoi(value)
+				if err != nil || concurrency < 1 {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_CONCURRENCY: %q is not a positive integer", value)
+				}
+				environment.Concurrency = concurrency
+			case "BP_NODE_RUN_SCRIPTS_WORKSPACES":
+				workspaces, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_WORKSPACES: %w", err)
+				}
+				environment.Workspaces = workspaces
+			case "BP_NODE_RUN_SCRIPTS_WORKSPACE_FILTER":
+				for _, pattern := range strings.Split(value, ",") {
+					if pattern = strings.TrimSpace(pattern); pattern == "" {
+						continue
+					}
+
+					if _, err := path.Match(strings.TrimSuffix(pattern, "..."), ""); err != nil {
+						return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_WORKSPACE_FILTER: invalid pattern %q: %w", pattern, err)
+					}
+					environment.WorkspaceFilter = append(environment.WorkspaceFilter, pattern)
+				}
+			case "BP_NODE_RUN_SCRIPTS_FORCE_REBUILD":
+				force, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_FORCE_REBUILD: %w", err)
+				}
+				environment.ForceRebuild = force
+			case "BP_NODE_RUN_SCRIPTS_TOOL_CACHES":
+				for _, pattern := range strings.Split(value, ",") {
+					if pattern = strings.TrimSpace(pattern); pattern == "" {
+						continue
+					}
+
+					if _, err := path.Match(pattern, ""); err != nil || !filepath.IsLocal(pattern) {
+						return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_TOOL_CACHES: invalid pattern %q", pattern)
+					}
+					environment.ToolCaches = append(environment.ToolCaches, pattern)
+				}
+			case "BP_NODE_RUN_SCRIPTS_TOOL_CACHE_LIMIT":
+				limit, err := parseSize(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_TOOL_CACHE_LIMIT: %w", err)
+				}
+				environment.ToolCacheLimit = limit
+			case "BP_NODE_RUN_SCRIPTS_RUN_LIFECYCLE_SCRIPTS":
+				run, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_RUN_LIFECYCLE_SCRIPTS: %w", err)
+				}
+				environment.RunLifecycleScripts = run
+			case "BP_NODE_RUN_SCRIPTS_DISABLE_TOOL_CACHES":
+				disable, err := strconv.ParseBool(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_DISABLE_TOOL_CACHES: %w", err)
+				}
+				environment.DisableToolCaches = disable
+			case "BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS":
+				for _, entry := range strings.Split(value, ",") {
+					if entry = strings.TrimSpace(entry); entry == "" {
+						continue
+					}
+
+					output, link, _ := strings.Cut(entry, "=")
+					if !filepath.IsLocal(output) || (link != "" && !filepath.IsLocal(link)) {
+						return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS: %q is not within the project", entry)
+					}
+
+					if filepath.Clean(output) == "." || (link != "" && filepath.Clean(link) == ".") {
+						return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS: %q names the project itself", entry)
+					}
+					environment.LaunchOutputs = append(environment.LaunchOutputs, LaunchOutput{
+						Path: filepath.ToSlash(filepath.Clean(output)),
+						Link: link,
+					})
+				}
+			case "BP_NODE_RUN_SCRIPTS_PROJECT_PATHS":
+				for _, path := range strings.Split(value, ",") {
+					if path = strings.TrimSpace(path); path != "" {
+						environment.ProjectPaths = append(environment.ProjectPaths, path)
+					}
+				}
+			case "BP_NODE_RUN_SCRIPTS_DOTENV_FILES":
+				for _, name := range strings.Split(value, ",") {
+					if name = strings.TrimSpace(name); name == "" {
+						continue
+					}
+
+					if !filepath.IsLocal(name) {
+						return Environment{}, fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS_DOTENV_FILES: %q is not within the project", name)
+					}
+					environment.DotenvFiles = append(environment.DotenvFiles, name)
+				}
+			}
+
+			if script, ok := strings.CutPrefix(key, "BP_NODE_RUN_SCRIPT_ARGS_"); ok {
+				args, err := splitArgs(value)
+				if err != nil {
+					return Environment{}, fmt.Errorf("failed to parse %s: %w", key, err)
+				}
+
+				if environment.ScriptArgs == nil {
+					environment.ScriptArgs = map[string][]string{}
+				}
+				environment.ScriptArgs[scriptEnvName(script)] = args
+			}
+
+			if script, ok := strings.CutPrefix(key, "BP_NODE_RUN_SCRIPT_TIMEOUT_"); ok {
+				timeout, err := parseDuration(key, value)
+				if err != nil {
+					return Environment{}, err
+				}
+
+				if environment.ScriptTimeouts == nil {
+					environment.ScriptTimeouts = map[string]time.Duration{}
+				}
+				environment.ScriptTimeouts[scriptEnvName(script)] = timeout
+			}
+
+			if suffix, ok := strings.CutPrefix(key, "BP_NODE_RUN_SCRIPT_ENV_"); ok {
+				if environment.ScriptEnv == nil {
+					environment.ScriptEnv = map[string]string{}
+				}
+				environment.ScriptEnv[suffix] = value
 			}
 		}
 	}
 
-	return environment
+	return environment, nil
+}
+
+func parseDuration(key, value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("failed to parse %s: duration must not be negative", key)
+	}
+
+	return duration, nil
+}
+
+// parseSize parses a positive size in bytes, optionally suffixed with K, M or
+// G for kibibytes, mebibytes or gibibytes.
+func parseSize(value string) (int64, error) {
+	number, unit := strings.TrimSpace(value), int64(1)
+	for suffix, multiplier := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if trimmed, ok := strings.CutSuffix(strings.ToUpper(number), suffix); ok {
+			number, unit = trimmed, multiplier
+		}
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 1 {
+		return 0, fmt.Errorf("%q is not a positive size", value)
+	}
+
+	return size * unit, nil
 }
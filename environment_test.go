@@ -2,6 +2,7 @@ package noderunscript_test
 
 import (
 	"testing"
+	"time"
 
 	noderunscript "github.com/paketo-buildpacks/node-run-script"
 	"github.com/sclevine/spec"
@@ -13,20 +14,26 @@ func testEnvironment(t *testing.T, context spec.G, it spec.S) {
 	var Expect = NewWithT(t).Expect
 
 	it("returns a parsed environment", func() {
-		environment := noderunscript.LoadEnvironment([]string{
+		environment, err := noderunscript.LoadEnvironment([]string{
 			"BP_NODE_RUN_SCRIPTS=some-node-run-scripts-value",
+			"BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER=some-package-manager-value",
+			"BP_NODE_RUN_SCRIPTS_IF_PRESENT=true",
 			"LOG_LEVEL=some-log-level-value",
 		})
+		Expect(err).NotTo(HaveOccurred())
 
 		Expect(environment).To(Equal(noderunscript.Environment{
 			LogLevel:       "some-log-level-value",
 			NodeRunScripts: "some-node-run-scripts-value",
+			PackageManager: "some-package-manager-value",
+			IfPresent:      true,
 		}))
 	})
 
 	context("when no values are set", func() {
 		it("uses the defaults", func() {
-			environment := noderunscript.LoadEnvironment([]string{})
+			environment, err := noderunscript.LoadEnvironment([]string{})
+			Expect(err).NotTo(HaveOccurred())
 
 			Expect(environment).To(Equal(noderunscript.Environment{
 				LogLevel:       "INFO",
@@ -37,12 +44,393 @@ func testEnvironment(t *testing.T, context spec.G, it spec.S) {
 
 	context("when explicit empty values are given", func() {
 		it("uses the empty values", func() {
-			environment := noderunscript.LoadEnvironment([]string{
+			environment, err := noderunscript.LoadEnvironment([]string{
 				"BP_NODE_RUN_SCRIPTS=",
 				"LOG_LEVEL=",
 			})
+			Expect(err).NotTo(HaveOccurred())
 
 			Expect(environment).To(Equal(noderunscript.Environment{}))
 		})
 	})
+
+	context("when script arguments are given", func() {
+		it("splits them like a shell would", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				`BP_NODE_RUN_SCRIPT_ARGS_BUILD=--mode staging --base "/my app/"`,
+				`BP_NODE_RUN_SCRIPT_ARGS_build_css=--title 'It'\''s here' --empty '' a\ b`,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.ScriptArgs).To(Equal(map[string][]string{
+				"BUILD":     {"--mode", "staging", "--base", "/my app/"},
+				"BUILD_CSS": {"--title", "It's here", "--empty", "", "a b"},
+			}))
+		})
+	})
+
+	context("when script environment variables are given", func() {
+		it("keeps them keyed by their suffix", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPT_ENV_BUILD_NODE_ENV=production",
+				"BP_NODE_RUN_SCRIPT_ENV_test_smoke_NODE_ENV=test",
+				"BP_NODE_RUN_SCRIPT_ENV_BUILD_EMPTY=",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.ScriptEnv).To(Equal(map[string]string{
+				"BUILD_NODE_ENV":      "production",
+				"test_smoke_NODE_ENV": "test",
+				"BUILD_EMPTY":         "",
+			}))
+		})
+	})
+
+	context("when dotenv files are given", func() {
+		it("keeps them in order", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_DOTENV_FILES=.env, .env.production,,",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.DotenvFiles).To(Equal([]string{".env", ".env.production"}))
+		})
+	})
+
+	context("when the default environment is configured", func() {
+		it("parses the settings", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_DISABLE_DEFAULT_ENV=true",
+				"BP_NODE_RUN_SCRIPTS_SOURCE_DATE_EPOCH=1700000000",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.DisableDefaultEnv).To(BeTrue())
+			Expect(environment.SourceDateEpoch).To(Equal("1700000000"))
+		})
+	})
+
+	context("when redact patterns are given", func() {
+		it("adds them to the defaults", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_REDACT_PATTERNS=*_DSN, SENTRY_*,",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.RedactPatterns).To(Equal([]string{"*_DSN", "SENTRY_*"}))
+		})
+	})
+
+	context("when timeouts are given", func() {
+		it("parses the durations", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_TIMEOUT=10m",
+				"BP_NODE_RUN_SCRIPTS_TIMEOUT_GRACE_PERIOD=30s",
+				"BP_NODE_RUN_SCRIPT_TIMEOUT_build_css=1m30s",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.Timeout).To(Equal(10 * time.Minute))
+			Expect(environment.GracePeriod).To(Equal(30 * time.Second))
+			Expect(environment.ScriptTimeouts).To(Equal(map[string]time.Duration{
+				"BUILD_CSS": 90 * time.Second,
+			}))
+		})
+	})
+
+	context("when a retry policy is given", func() {
+		it("parses the policy", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_MAX_ATTEMPTS=3",
+				"BP_NODE_RUN_SCRIPTS_RETRY_BACKOFF=5s",
+				"BP_NODE_RUN_SCRIPTS_RETRY_EXIT_CODES=1, 137",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.Retry).To(Equal(noderunscript.RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     5 * time.Second,
+				ExitCodes:   []int{1, 137},
+			}))
+		})
+	})
+
+	context("when failures are tolerated", func() {
+		it("parses the settings", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_CONTINUE_ON_ERROR=true",
+				"BP_NODE_RUN_SCRIPTS_WARN_ONLY=lint, typecheck",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.ContinueOnError).To(BeTrue())
+			Expect(environment.WarnOnly).To(Equal([]string{"lint", "typecheck"}))
+		})
+	})
+
+	context("when several project paths are given", func() {
+		it("parses them", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_PROJECT_PATHS=frontend, services/bff",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.ProjectPaths).To(Equal([]string{"frontend", "services/bff"}))
+		})
+	})
+
+	context("when running the scripts of workspace packages", func() {
+		it("parses the settings", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_WORKSPACES=true",
+				"BP_NODE_RUN_SCRIPTS_WORKSPACE_FILTER=@acme/web..., @acme/api",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.Workspaces).To(BeTrue())
+			Expect(environment.WorkspaceFilter).To(Equal([]string{"@acme/web...", "@acme/api"}))
+		})
+	})
+
+	context("when lifecycle scripts are run explicitly", func() {
+		it("parses the setting", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_RUN_LIFECYCLE_SCRIPTS=true",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.RunLifecycleScripts).To(BeTrue())
+		})
+	})
+
+	context("when a rebuild is forced", func() {
+		it("parses the setting", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_FORCE_REBUILD=true",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.ForceRebuild).To(BeTrue())
+		})
+	})
+
+	context("when tool caches are configured", func() {
+		it("parses the settings", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_TOOL_CACHES=.turbo, packages/*/.cache",
+				"BP_NODE_RUN_SCRIPTS_TOOL_CACHE_LIMIT=512M",
+				"BP_NODE_RUN_SCRIPTS_DISABLE_TOOL_CACHES=false",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.ToolCaches).To(Equal([]string{".turbo", "packages/*/.cache"}))
+			Expect(environment.ToolCacheLimit).To(Equal(int64(512 << 20)))
+			Expect(environment.DisableToolCaches).To(BeFalse())
+		})
+	})
+
+	context("when launch outputs are declared", func() {
+		it("parses them with their link paths", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS=dist, build/client/=public/app",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.LaunchOutputs).To(Equal([]noderunscript.LaunchOutput{
+				{Path: "dist"},
+				{Path: "build/client", Link: "public/app"},
+			}))
+		})
+	})
+
+	context("when scripts run in parallel", func() {
+		it("parses the settings", func() {
+			environment, err := noderunscript.LoadEnvironment([]string{
+				"BP_NODE_RUN_SCRIPTS_PARALLEL=true",
+				"BP_NODE_RUN_SCRIPTS_CONCURRENCY=4",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(environment.Parallel).To(BeTrue())
+			Expect(environment.Concurrency).To(Equal(4))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when $BP_NODE_RUN_SCRIPTS_IF_PRESENT is not a boolean", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_IF_PRESENT=sometimes",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS_IF_PRESENT")))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_CONTINUE_ON_ERROR is not a boolean", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_CONTINUE_ON_ERROR=sometimes",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS_CONTINUE_ON_ERROR")))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_DISABLE_DEFAULT_ENV is not a boolean", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_DISABLE_DEFAULT_ENV=sometimes",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS_DISABLE_DEFAULT_ENV")))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_REDACT_PATTERNS holds an invalid pattern", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_REDACT_PATTERNS=*_TOKEN,[A-",
+				})
+				Expect(err).To(MatchError(ContainSubstring(`failed to parse BP_NODE_RUN_SCRIPTS_REDACT_PATTERNS: invalid pattern "[A-"`)))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_MAX_ATTEMPTS is not a positive integer", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_MAX_ATTEMPTS=0",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_MAX_ATTEMPTS: "0" is not a positive integer`))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_PARALLEL is not a boolean", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_PARALLEL=sometimes",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS_PARALLEL")))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_FORCE_REBUILD is not a boolean", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_FORCE_REBUILD=always",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS_FORCE_REBUILD")))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_TOOL_CACHES holds a pattern outside of the project", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_TOOL_CACHES=../cache",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_TOOL_CACHES: invalid pattern "../cache"`))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_TOOL_CACHE_LIMIT is not a size", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_TOOL_CACHE_LIMIT=lots",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_TOOL_CACHE_LIMIT: "lots" is not a positive size`))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS holds a path outside of the project", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS=dist=/srv/www",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS: "dist=/srv/www" is not within the project`))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS names the project itself", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS=dist/..",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS: "dist/.." names the project itself`))
+
+				_, err = noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS=dist=.",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_LAUNCH_OUTPUTS: "dist=." names the project itself`))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_DOTENV_FILES names a file outside of the project", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_DOTENV_FILES=.env,../../etc/x",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_DOTENV_FILES: "../../etc/x" is not within the project`))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_WORKSPACE_FILTER holds an invalid pattern", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_WORKSPACE_FILTER=@acme/[",
+				})
+				Expect(err).To(MatchError(ContainSubstring(`failed to parse BP_NODE_RUN_SCRIPTS_WORKSPACE_FILTER: invalid pattern "@acme/["`)))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_CONCURRENCY is not a positive integer", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_CONCURRENCY=-1",
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS_CONCURRENCY: "-1" is not a positive integer`))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_RETRY_EXIT_CODES holds something other than integers", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_RETRY_EXIT_CODES=1,SIGKILL",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS_RETRY_EXIT_CODES")))
+			})
+		})
+
+		context("when a timeout is not a duration", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPT_TIMEOUT_BUILD=forever",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPT_TIMEOUT_BUILD")))
+			})
+		})
+
+		context("when a timeout is negative", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_TIMEOUT=-5m",
+				})
+				Expect(err).To(MatchError("failed to parse BP_NODE_RUN_SCRIPTS_TIMEOUT: duration must not be negative"))
+			})
+		})
+
+		context("when $BP_NODE_RUN_SCRIPTS_SOURCE_DATE_EPOCH is not a number", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					"BP_NODE_RUN_SCRIPTS_SOURCE_DATE_EPOCH=yesterday",
+				})
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS_SOURCE_DATE_EPOCH")))
+			})
+		})
+
+		context("when a script argument has an unterminated quote", func() {
+			it("returns an error", func() {
+				_, err := noderunscript.LoadEnvironment([]string{
+					`BP_NODE_RUN_SCRIPT_ARGS_BUILD=--base "/app/`,
+				})
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPT_ARGS_BUILD: unterminated " quote in "--base \"/app/"`))
+			})
+		})
+	})
 }
@@ -0,0 +1,155 @@
+package noderunscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+)
+
+// ErrTimeout is returned when a script runs for longer than its timeout.
+var ErrTimeout = errors.New("timed out")
+
+// DefaultGracePeriod is how long a timed out script is given to exit after
+// SIGTERM before it is sent SIGKILL.
+const DefaultGracePeriod = 10 * time.Second
+
+// ContextExecutable is an Executable that can be cancelled through a context.
+//
+//go:generate faux --interface ContextExecutable --output fakes/context_executable.go
+type ContextExecutable interface {
+	Executable
+	ExecuteContext(ctx context.Context, execution pexec.Execution) error
+}
+
+// ProcessGroupExecutable runs an executable in its own process group so that,
+// when cancelled, it can be terminated along with every process it started.
+type ProcessGroupExecutable struct {
+	name        string
+	gracePeriod time.Duration
+}
+
+// NewProcessGroupExecutable returns an executable that looks up the given
+// name on the $PATH, like pexec.NewExecutable. When cancelled, its process
+// group is sent SIGTERM, and then SIGKILL if it has not exited after the
+// grace period, or DefaultGracePeriod if the grace period is zero.
+func NewProcessGroupExecutable(name string, gracePeriod time.Duration) ProcessGroupExecutable {
+	if gracePeriod == 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+
+	return ProcessGroupExecutable{
+		name:        name,
+		gracePeriod: gracePeriod,
+	}
+}
+
+func (e ProcessGroupExecutable) Execute(execution pexec.Execution) error {
+	return e.ExecuteContext(context.Background(), execution)
+}
+
+func (e ProcessGroupExecutable) ExecuteContext(ctx context.Context, execution pexec.Execution) error {
+	executable, err := lookPath(e.name, execution.Env)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executable, execution.Args...)
+	cmd.Dir = execution.Dir
+	if len(execution.Env) > 0 {
+		cmd.Env = execution.Env
+	}
+	cmd.Stdout = execution.Stdout
+	cmd.Stderr = execution.Stderr
+	cmd.Stdin = execution.Stdin
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Signalling the negated process ID signals the whole process group.
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+
+	select {
+	case <-done:
+	case <-time.After(e.gracePeriod):
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+	}
+
+	return ctx.Err()
+}
+
+// lookPath finds the named executable on the $PATH of the given environment,
+// falling back to the $PATH of the current process.
+func lookPath(name string, env []string) (string, error) {
+	if strings.Contains(name, "/") {
+		return exec.LookPath(name)
+	}
+
+	path := os.Getenv("PATH")
+	for _, variable := range env {
+		if value, ok := strings.CutPrefix(variable, "PATH="); ok {
+			path = value
+		}
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// execute runs a script, cancelling it once the given context is done or its
+// timeout, if any, has passed.
+func execute(ctx context.Context, executable Executable, script Script, execution pexec.Execution) error {
+	contextExecutable, ok := executable.(ContextExecutable)
+	if !ok {
+		if script.Timeout > 0 {
+			return fmt.Errorf("cannot apply the timeout of script '%s': its executable does not support cancellation", script.Name)
+		}
+
+		return executable.Execute(execution)
+	}
+
+	if script.Timeout == 0 {
+		return contextExecutable.ExecuteContext(ctx, execution)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, script.Timeout)
+	defer cancel()
+
+	err := contextExecutable.ExecuteContext(ctx, execution)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("script '%s' %w after %s", script.Name, ErrTimeout, script.Timeout)
+	}
+
+	return err
+}
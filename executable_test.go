@@ -0,0 +1,119 @@
+package noderunscript_test
+
+import (
+	"bytes"
+	gocontext "context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	noderunscript "github.com/paketo-buildpacks/node-run-script"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testProcessGroupExecutable(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+		stdout     *bytes.Buffer
+		stderr     *bytes.Buffer
+		executable noderunscript.ProcessGroupExecutable
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+
+		stdout = bytes.NewBuffer(nil)
+		stderr = bytes.NewBuffer(nil)
+		executable = noderunscript.NewProcessGroupExecutable("sh", 100*time.Millisecond)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	it("runs the executable", func() {
+		err := executable.Execute(pexec.Execution{
+			Dir:    workingDir,
+			Args:   []string{"-c", `echo "$GREETING from $(pwd)"; echo some-error >&2`},
+			Env:    append(os.Environ(), "GREETING=hello"),
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resolved, err := filepath.EvalSymlinks(workingDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stdout.String()).To(Or(Equal("hello from "+workingDir+"\n"), Equal("hello from "+resolved+"\n")))
+		Expect(stderr.String()).To(Equal("some-error\n"))
+	})
+
+	it("looks up the executable on the $PATH of the execution", func() {
+		Expect(os.WriteFile(filepath.Join(workingDir, "some-executable"), []byte("#!/bin/sh\necho some-output\n"), 0755)).To(Succeed())
+
+		err := noderunscript.NewProcessGroupExecutable("some-executable", 0).Execute(pexec.Execution{
+			Env:    []string{"PATH=" + workingDir},
+			Stdout: stdout,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stdout.String()).To(Equal("some-output\n"))
+	})
+
+	context("when the context is cancelled", func() {
+		it("terminates the whole process group", func() {
+			ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := executable.ExecuteContext(ctx, pexec.Execution{
+				Args:   []string{"-c", "sleep 30 & wait"},
+				Stdout: stdout,
+			})
+			Expect(err).To(MatchError(gocontext.DeadlineExceeded))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		})
+
+		context("when the process ignores SIGTERM", func() {
+			it("kills it after the grace period", func() {
+				ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 100*time.Millisecond)
+				defer cancel()
+
+				start := time.Now()
+				err := executable.ExecuteContext(ctx, pexec.Execution{
+					Args:   []string{"-c", `trap "" TERM; sleep 30 & wait`},
+					Stdout: stdout,
+				})
+				Expect(err).To(MatchError(gocontext.DeadlineExceeded))
+				Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+				Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			})
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the executable cannot be found", func() {
+			it("returns an error", func() {
+				err := noderunscript.NewProcessGroupExecutable("no-such-executable", 0).Execute(pexec.Execution{
+					Env: []string{"PATH=" + workingDir},
+				})
+				Expect(err).To(MatchError(ContainSubstring(`"no-such-executable": executable file not found in $PATH`)))
+			})
+		})
+
+		context("when the executable fails", func() {
+			it("returns an error", func() {
+				err := executable.Execute(pexec.Execution{
+					Args: []string{"-c", "exit 3"},
+				})
+				Expect(err).To(MatchError("exit status 3"))
+			})
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package noderunscript
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// ScriptFailure records a script that failed.
+type ScriptFailure struct {
+	Name string
+
+	// Project is the path of the project the script belongs to when several
+	// projects are built.
+	Project string
+
+	Duration time.Duration
+	Err      error
+}
+
+// label names the script along with its project, if any.
+func (f ScriptFailure) label() string {
+	if f.Project == "" {
+		return f.Name
+	}
+
+	return f.Project + ": " + f.Name
+}
+
+// Reason describes why the script failed, preferring its exit code.
+func (f ScriptFailure) Reason() string {
+	if code, ok := exitCode(f.Err); ok {
+		return fmt.Sprintf("exit code %d", code)
+	}
+
+	return f.Err.Error()
+}
+
+// ScriptFailures is the error returned by Build when it continues past
+// failing scripts and at least one of them failed.
+type ScriptFailures []ScriptFailure
+
+func (f ScriptFailures) Error() string {
+	var reasons []string
+	for _, failure := range f {
+		reasons = append(reasons, fmt.Sprintf("'%s' (%s)", failure.label(), failure.Reason()))
+	}
+
+	return fmt.Sprintf("%d script(s) failed: %s", len(f), strings.Join(reasons, ", "))
+}
+
+func (f ScriptFailures) Unwrap() []error {
+	var errs []error
+	for _, failure := range f {
+		errs = append(errs, failure.Err)
+	}
+
+	return errs
+}
+
+// logFailureSummary logs a table of the failed scripts, marking those that
+// only produce a warning.
+func logFailureSummary(logger scribe.Logger, failures, warnings []ScriptFailure) {
+	width := 0
+	for _, failure := range slices.Concat(failures, warnings) {
+		width = max(width, len(failure.label()))
+	}
+
+	logger.Subprocess("Failure summary:")
+	for _, failure := range failures {
+		logger.Action("%-*s  %-10s  %s", width, failure.label(), failure.Duration.Round(time.Millisecond), failure.Reason())
+	}
+	for _, warning := range warnings {
+		logger.Action("%-*s  %-10s  %s (warn only)", width, warning.label(), warning.Duration.Round(time.Millisecond), warning.Reason())
+	}
+	logger.Break()
+}
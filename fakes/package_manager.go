@@ -0,0 +1,139 @@
+package fakes
+
+import "sync"
+
+type PackageManager struct {
+	DetectCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			WorkingDir string
+		}
+		Returns struct {
+			Bool  bool
+			Error error
+		}
+		Stub func(string) (bool, error)
+	}
+	EnvCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			WorkingDir string
+		}
+		Returns struct {
+			StringSlice []string
+			Error       error
+		}
+		Stub func(string) ([]string, error)
+	}
+	NameCall struct {
+		sync.Mutex
+		CallCount int
+		Returns   struct {
+			String string
+		}
+		Stub func() string
+	}
+	RequirementsCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			WorkingDir string
+			Version    string
+		}
+		Returns struct {
+			StringSlice []string
+			Error       error
+		}
+		Stub func(string, string) ([]string, error)
+	}
+	RunArgsCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			Script string
+			Args   []string
+		}
+		Returns struct {
+			StringSlice []string
+		}
+		Stub func(string, []string) []string
+	}
+	RunsLifecycleScriptsCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			WorkingDir string
+			Version    string
+		}
+		Returns struct {
+			Bool  bool
+			Error error
+		}
+		Stub func(string, string) (bool, error)
+	}
+}
+
+func (f *PackageManager) Detect(param1 string) (bool, error) {
+	f.DetectCall.Lock()
+	defer f.DetectCall.Unlock()
+	f.DetectCall.CallCount++
+	f.DetectCall.Receives.WorkingDir = param1
+	if f.DetectCall.Stub != nil {
+		return f.DetectCall.Stub(param1)
+	}
+	return f.DetectCall.Returns.Bool, f.DetectCall.Returns.Error
+}
+func (f *PackageManager) Env(param1 string) ([]string, error) {
+	f.EnvCall.Lock()
+	defer f.EnvCall.Unlock()
+	f.EnvCall.CallCount++
+	f.EnvCall.Receives.WorkingDir = param1
+	if f.EnvCall.Stub != nil {
+		return f.EnvCall.Stub(param1)
+	}
+	return f.EnvCall.Returns.StringSlice, f.EnvCall.Returns.Error
+}
+func (f *PackageManager) Name() string {
+	f.NameCall.Lock()
+	defer f.NameCall.Unlock()
+	f.NameCall.CallCount++
+	if f.NameCall.Stub != nil {
+		return f.NameCall.Stub()
+	}
+	return f.NameCall.Returns.String
+}
+func (f *PackageManager) Requirements(param1 string, param2 string) ([]string, error) {
+	f.RequirementsCall.Lock()
+	defer f.RequirementsCall.Unlock()
+	f.RequirementsCall.CallCount++
+	f.RequirementsCall.Receives.WorkingDir = param1
+	f.RequirementsCall.Receives.Version = param2
+	if f.RequirementsCall.Stub != nil {
+		return f.RequirementsCall.Stub(param1, param2)
+	}
+	return f.RequirementsCall.Returns.StringSlice, f.RequirementsCall.Returns.Error
+}
+func (f *PackageManager) RunArgs(param1 string, param2 []string) []string {
+	f.RunArgsCall.Lock()
+	defer f.RunArgsCall.Unlock()
+	f.RunArgsCall.CallCount++
+	f.RunArgsCall.Receives.Script = param1
+	f.RunArgsCall.Receives.Args = param2
+	if f.RunArgsCall.Stub != nil {
+		return f.RunArgsCall.Stub(param1, param2)
+	}
+	return f.RunArgsCall.Returns.StringSlice
+}
+func (f *PackageManager) RunsLifecycleScripts(param1 string, param2 string) (bool, error) {
+	f.RunsLifecycleScriptsCall.Lock()
+	defer f.RunsLifecycleScriptsCall.Unlock()
+	f.RunsLifecycleScriptsCall.CallCount++
+	f.RunsLifecycleScriptsCall.Receives.WorkingDir = param1
+	f.RunsLifecycleScriptsCall.Receives.Version = param2
+	if f.RunsLifecycleScriptsCall.Stub != nil {
+		return f.RunsLifecycleScriptsCall.Stub(param1, param2)
+	}
+	return f.RunsLifecycleScriptsCall.Returns.Bool, f.RunsLifecycleScriptsCall.Returns.Error
+}
@@ -0,0 +1,187 @@
+package noderunscript
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ScriptConfigFile is the file, in the project directory, that configures
+// the dependencies between scripts and their cached outputs. It takes
+// precedence over the "paketo" section of package.json.
+const ScriptConfigFile = "node-run-script.json"
+
+// scriptConfig is the configuration read from ScriptConfigFile or from the
+// "paketo" section of package.json.
+type scriptConfig struct {
+	// DependsOn maps each script to the scripts that must finish before it
+	// runs.
+	DependsOn map[string][]string `json:"dependsOn"`
+
+	// Cache maps each script to the files it reads and writes, so that it
+	// can be skipped when its inputs have not changed.
+	Cache map[string]scriptCache `json:"cache"`
+}
+
+// scriptCache declares the inputs and outputs of a script, relative to the
+// directory of the script. Inputs may be paths or glob patterns, while outputs
+// must be paths, as they are copied into and out of the cache as they are.
+type scriptCache struct {
+	Inputs  []string `json:"inputs"`
+	Outputs []string `json:"outputs"`
+}
+
+// loadScriptConfig returns the script configuration, checked against the
+// scripts in package.json.
+func loadScriptConfig(workingDir string, pkg packageJSON) (scriptConfig, error) {
+	config, source := pkg.Paketo, "package.json"
+
+	content, err := os.ReadFile(filepath.Join(workingDir, ScriptConfigFile))
+	switch {
+	case err == nil:
+		config, source = scriptConfig{}, ScriptConfigFile
+		if err := json.Unmarshal(content, &config); err != nil {
+			return scriptConfig{}, fmt.Errorf("failed to parse %s: %w", ScriptConfigFile, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return scriptConfig{}, fmt.Errorf("failed to read %s: %w", ScriptConfigFile, err)
+	}
+
+	names := slices.Sorted(maps.Keys(config.DependsOn))
+	for _, name := range names {
+		if !slices.Contains(pkg.Scripts, name) {
+			return scriptConfig{}, fmt.Errorf("invalid script dependencies in %s: script %q is not in package.json", source, name)
+		}
+
+		for _, dependency := range config.DependsOn[name] {
+			if !slices.Contains(pkg.Scripts, dependency) {
+				return scriptConfig{}, fmt.Errorf("invalid script dependencies in %s: script %q depends on %q, which is not in package.json", source, name, dependency)
+			}
+		}
+	}
+
+	if cycle := findCycle(names, config.DependsOn); cycle != nil {
+		return scriptConfig{}, fmt.Errorf("invalid script dependencies in %s: found a cycle: %s", source, strings.Join(cycle, " -> "))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Cache)) {
+		if !slices.Contains(pkg.Scripts, name) {
+			return scriptConfig{}, fmt.Errorf("invalid script cache in %s: script %q is not in package.json", source, name)
+		}
+
+		if len(config.Cache[name].Outputs) == 0 {
+			return scriptConfig{}, fmt.Errorf("invalid script cache in %s: script %q declares no outputs", source, name)
+		}
+
+		// Without inputs, changes to the sources would never be noticed.
+		if len(config.Cache[name].Inputs) == 0 {
+			return scriptConfig{}, fmt.Errorf("invalid script cache in %s: script %q declares no inputs", source, name)
+		}
+
+		for _, output := range config.Cache[name].Outputs {
+			if !filepath.IsLocal(output) {
+				return scriptConfig{}, fmt.Errorf("invalid script cache in %s: output %q of script %q is not within the project", source, output, name)
+			}
+
+			if strings.ContainsAny(output, "*?[") {
+				return scriptConfig{}, fmt.Errorf("invalid script cache in %s: output %q of script %q must be a path, not a glob pattern", source, output, name)
+			}
+
+			// Restoring an output replaces it, so it must not hold the
+			// sources of the script.
+			dir := path.Clean(filepath.ToSlash(output))
+			if dir == "." {
+				return scriptConfig{}, fmt.Errorf("invalid script cache in %s: output %q of script %q is the project itself", source, output, name)
+			}
+
+			for _, input := range config.Cache[name].Inputs {
+				if cleaned := path.Clean(filepath.ToSlash(input)); cleaned == dir || strings.HasPrefix(cleaned, dir+"/") {
+					return scriptConfig{}, fmt.Errorf("invalid script cache in %s: output %q of script %q contains its input %q", source, output, name, input)
+				}
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// findCycle returns the first cycle found in the graph, starting and ending
+// with the same script, or nil if there is none.
+func findCycle(names []string, graph map[string][]string) []string {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	var (
+		path  []string
+		state = map[string]int{}
+		visit func(name string) []string
+	)
+
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			return append(slices.Clone(path[slices.Index(path, name):]), name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dependency := range graph[name] {
+			if cycle := visit(dependency); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// sortScripts orders the scripts so that each comes after those it depends
+// on, otherwise keeping them in the order given.
+func sortScripts(scripts []Script) []Script {
+	var (
+		sorted []Script
+		added  = map[string]bool{}
+		visit  func(script Script)
+	)
+
+	visit = func(script Script) {
+		if added[script.label()] {
+			return
+		}
+		added[script.label()] = true
+
+		for _, dependency := range script.DependsOn {
+			if index := slices.IndexFunc(scripts, func(s Script) bool { return s.label() == dependency }); index >= 0 {
+				visit(scripts[index])
+			}
+		}
+
+		sorted = append(sorted, script)
+	}
+
+	for _, script := range scripts {
+		visit(script)
+	}
+
+	return sorted
+}
@@ -12,6 +12,10 @@ func TestUnitNodeRunScript(t *testing.T) {
 	suite("Build", testBuild)
 	suite("Detect", testDetect)
 	suite("Environment", testEnvironment)
+	suite("PackageManager", testPackageManager)
+	suite("PackageManagers", testPackageManagers)
+	suite("ProcessGroupExecutable", testProcessGroupExecutable)
+	suite("RedactingWriter", testRedactingWriter)
 	suite("Scripts", testScripts)
 	suite.Run(t)
 }
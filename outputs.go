@@ -0,0 +1,166 @@
+package noderunscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	packitfs "github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// LaunchOutput is a directory of build outputs that is moved into a launch
+// layer of its own, so that it is only exported again when it changes.
+type LaunchOutput struct {
+	// Path is the directory, relative to the project directory.
+	Path string
+
+	// Link is where the symlink to the layer is left, relative to the project
+	// directory. It defaults to Path.
+	Link string
+}
+
+// errLaunchOutputMissing is returned when the scripts did not create a launch
+// output.
+var errLaunchOutputMissing = errors.New("was not created by the scripts")
+
+// launchLayerName returns the name of the layer holding the output of the
+// project. The readable part of the name flattens the path, so it ends with a
+// digest of the path that keeps outputs such as a-b and a/b apart.
+func launchLayerName(project string, output LaunchOutput) string {
+	key := path.Join(project, output.Path)
+	sum := sha256.Sum256([]byte(key))
+
+	return fmt.Sprintf("outputs-%s-%s", strings.ReplaceAll(key, "/", "-"), hex.EncodeToString(sum[:4]))
+}
+
+// moveLaunchOutput moves the output of the project into its launch layer and
+// leaves a symlink to the layer in its place. When the output is the same as
+// in the previous build, the layer of the previous image is reused instead.
+func moveLaunchOutput(layers packit.Layers, project project, output LaunchOutput, logger scribe.Logger) (packit.Layer, error) {
+	// Moving the project itself would replace it with a link, and reusing
+	// the previous layer would delete it.
+	for _, name := range []string{output.Path, output.Link} {
+		if name != "" && (!filepath.IsLocal(name) || filepath.Clean(name) == ".") {
+			return packit.Layer{}, fmt.Errorf("launch output %q must be a directory within the project", name)
+		}
+	}
+
+	source := filepath.Join(project.Dir, filepath.FromSlash(output.Path))
+
+	info, err := os.Lstat(source)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return packit.Layer{}, fmt.Errorf("launch output %s %w", output.Path, errLaunchOutputMissing)
+		}
+
+		return packit.Layer{}, err
+	}
+
+	if !info.IsDir() {
+		return packit.Layer{}, fmt.Errorf("launch output %s is not a directory", output.Path)
+	}
+
+	digest, err := outputDigest(source)
+	if err != nil {
+		return packit.Layer{}, fmt.Errorf("failed to calculate the digest of %s: %w", output.Path, err)
+	}
+
+	layer, err := layers.Get(launchLayerName(project.Name, output))
+	if err != nil {
+		return packit.Layer{}, fmt.Errorf("failed to get layer: %w", err)
+	}
+
+	if previous, ok := layer.Metadata["digest"].(string); ok && previous == digest {
+		logger.Subprocess("Reusing the layer of %s, which has not changed", path.Join(project.Name, output.Path))
+
+		if err := os.RemoveAll(source); err != nil {
+			return packit.Layer{}, err
+		}
+	} else {
+		logger.Subprocess("Moving %s into a launch layer", path.Join(project.Name, output.Path))
+
+		layer, err = layer.Reset()
+		if err != nil {
+			return packit.Layer{}, err
+		}
+
+		if err := packitfs.Move(source, layer.Path); err != nil {
+			return packit.Layer{}, fmt.Errorf("failed to move %s into its layer: %w", output.Path, err)
+		}
+
+		layer.Metadata = map[string]interface{}{
+			"digest": digest,
+			"path":   output.Path,
+		}
+	}
+	layer.Launch = true
+
+	link := output.Link
+	if link == "" {
+		link = output.Path
+	}
+
+	linkPath := filepath.Join(project.Dir, filepath.FromSlash(link))
+	if _, err := os.Lstat(linkPath); err == nil {
+		return packit.Layer{}, fmt.Errorf("cannot link %s to its layer: %s already exists", output.Path, link)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(linkPath), os.ModePerm); err != nil {
+		return packit.Layer{}, err
+	}
+
+	if err := os.Symlink(layer.Path, linkPath); err != nil {
+		return packit.Layer{}, fmt.Errorf("failed to link %s to its layer: %w", output.Path, err)
+	}
+
+	return layer, nil
+}
+
+// outputDigest hashes the names, modes and contents of the files in the
+// directory, so that any change to the layer made from it changes the digest.
+func outputDigest(dir string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "mode %s %s\n", rel, info.Mode())
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "link %s %s\n", rel, target)
+		case entry.Type().IsRegular():
+			return hashFile(hash, dir, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,92 @@
+package noderunscript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type packageJSON struct {
+	Name           string            `json:"name"`
+	PackageManager string            `json:"packageManager"`
+	Scripts        scriptNames       `json:"scripts"`
+	Paketo         scriptConfig      `json:"paketo"`
+	Workspaces     workspacePatterns `json:"workspaces"`
+
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// scriptNames holds the names of the package.json scripts in the order in
+// which they are declared.
+type scriptNames []string
+
+func (s *scriptNames) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != json.Delim('{') {
+		return fmt.Errorf("expected scripts to be an object")
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		var value json.RawMessage
+		err = decoder.Decode(&value)
+		if err != nil {
+			return err
+		}
+
+		*s = append(*s, token.(string))
+	}
+
+	return nil
+}
+
+// workspacePatterns holds the patterns of the package.json "workspaces"
+// field, given either as an array or as the "packages" of an object.
+type workspacePatterns []string
+
+func (w *workspacePatterns) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var workspaces struct {
+			Packages []string `json:"packages"`
+		}
+		if err := json.Unmarshal(data, &workspaces); err != nil {
+			return err
+		}
+
+		*w = workspaces.Packages
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(w))
+}
+
+func parsePackageJSON(workingDir string) (packageJSON, error) {
+	file, err := os.Open(filepath.Join(workingDir, "package.json"))
+	if err != nil {
+		return packageJSON{}, fmt.Errorf("failed to open package.json: %w", err)
+	}
+	defer file.Close()
+
+	var pkg packageJSON
+	err = json.NewDecoder(file).Decode(&pkg)
+	if err != nil {
+		return packageJSON{}, fmt.Errorf("failed to parse package.json: %w", err)
+	}
+
+	return pkg, nil
+}
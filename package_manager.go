@@ -0,0 +1,115 @@
+package noderunscript
+
+import (
+	"slices"
+)
+
+// PackageManager describes a tool that can run the scripts defined in a
+// package.json file.
+//
+//go:generate faux --interface PackageManager --output fakes/package_manager.go
+type PackageManager interface {
+	// Name returns the name of the package manager, as used in the
+	// package.json "packageManager" field and the
+	// BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER environment variable.
+	Name() string
+
+	// Detect reports whether the project in the given directory uses this
+	// package manager, typically by looking for its lockfile.
+	Detect(workingDir string) (bool, error)
+
+	// Requirements returns the names of the build plan entries required to
+	// run scripts with this package manager, given its pinned version.
+	Requirements(workingDir string, version string) ([]string, error)
+
+	// RunArgs returns the arguments used to run the given script, passing
+	// through any additional arguments to the script itself.
+	RunArgs(script string, args []string) []string
+
+	// Env returns any environment variables, in KEY=VALUE form, that should
+	// be set on top of the build environment when running scripts.
+	Env(workingDir string) ([]string, error)
+
+	// RunsLifecycleScripts reports whether running a script also runs its
+	// pre and post lifecycle scripts, given the pinned version of the package
+	// manager. If not, they can be run explicitly with
+	// BP_NODE_RUN_SCRIPTS_RUN_LIFECYCLE_SCRIPTS.
+	RunsLifecycleScripts(workingDir string, version string) (bool, error)
+}
+
+// PackageManagerRegistry holds the package managers, and the executables used
+// to invoke them, that Detect and Build choose from.
+type PackageManagerRegistry struct {
+	fallback    PackageManager
+	managers    []PackageManager
+	executables map[string]Executable
+}
+
+// NewPackageManagerRegistry returns a registry that uses the given package
+// manager whenever no other registered package manager is detected.
+func NewPackageManagerRegistry(fallback PackageManager, executable Executable) *PackageManagerRegistry {
+	return &PackageManagerRegistry{
+		fallback: fallback,
+		executables: map[string]Executable{
+			fallback.Name(): executable,
+		},
+	}
+}
+
+// Register adds a package manager to the registry. Package managers are
+// detected in the order in which they were registered, and registering a
+// name that is already present replaces the existing package manager.
+func (r *PackageManagerRegistry) Register(manager PackageManager, executable Executable) {
+	r.executables[manager.Name()] = executable
+
+	if manager.Name() == r.fallback.Name() {
+		r.fallback = manager
+		return
+	}
+
+	index := slices.IndexFunc(r.managers, func(m PackageManager) bool { return m.Name() == manager.Name() })
+	if index >= 0 {
+		r.managers[index] = manager
+		return
+	}
+
+	r.managers = append(r.managers, manager)
+}
+
+// Managers returns the registered package managers in detection order, with
+// the fallback package manager last.
+func (r *PackageManagerRegistry) Managers() []PackageManager {
+	return append(slices.Clone(r.managers), r.fallback)
+}
+
+// Fallback returns the package manager used when no other is detected.
+func (r *PackageManagerRegistry) Fallback() PackageManager {
+	return r.fallback
+}
+
+// Lookup returns the registered package manager with the given name.
+func (r *PackageManagerRegistry) Lookup(name string) (PackageManager, bool) {
+	for _, manager := range r.Managers() {
+		if manager.Name() == name {
+			return manager, true
+		}
+	}
+
+	return nil, false
+}
+
+// Executable returns the executable registered for the named package manager.
+func (r *PackageManagerRegistry) Executable(name string) Executable {
+	return r.executables[name]
+}
+
+// Names returns the sorted names of all registered package managers.
+func (r *PackageManagerRegistry) Names() []string {
+	var names []string
+	for _, manager := range r.Managers() {
+		names = append(names, manager.Name())
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,111 @@
+package noderunscript_test
+
+import (
+	"testing"
+
+	noderunscript "github.com/paketo-buildpacks/node-run-script"
+	"github.com/paketo-buildpacks/node-run-script/fakes"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPackageManager(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		npmExec  *fakes.Executable
+		yarnExec *fakes.Executable
+		managers *noderunscript.PackageManagerRegistry
+	)
+
+	it.Before(func() {
+		npmExec = &fakes.Executable{}
+		yarnExec = &fakes.Executable{}
+
+		managers = noderunscript.NewPackageManagerRegistry(noderunscript.NewNPM(), npmExec)
+		managers.Register(noderunscript.NewYarn(), yarnExec)
+	})
+
+	context("Managers", func() {
+		it("returns the package managers in detection order with the fallback last", func() {
+			Expect(managers.Managers()).To(Equal([]noderunscript.PackageManager{
+				noderunscript.NewYarn(),
+				noderunscript.NewNPM(),
+			}))
+			Expect(managers.Fallback()).To(Equal(noderunscript.NewNPM()))
+		})
+	})
+
+	context("Lookup", func() {
+		it("returns the package manager with the given name", func() {
+			manager, ok := managers.Lookup("yarn")
+			Expect(ok).To(BeTrue())
+			Expect(manager).To(Equal(noderunscript.NewYarn()))
+
+			manager, ok = managers.Lookup("npm")
+			Expect(ok).To(BeTrue())
+			Expect(manager).To(Equal(noderunscript.NewNPM()))
+		})
+
+		context("when the package manager is not registered", func() {
+			it("reports that it was not found", func() {
+				_, ok := managers.Lookup("pnpm")
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+
+	context("Executable", func() {
+		it("returns the executable registered for the package manager", func() {
+			Expect(managers.Executable("npm")).To(BeIdenticalTo(npmExec))
+			Expect(managers.Executable("yarn")).To(BeIdenticalTo(yarnExec))
+		})
+	})
+
+	context("Names", func() {
+		it("returns the sorted names of the package managers", func() {
+			managers.Register(noderunscript.NewPNPM(), &fakes.Executable{})
+			Expect(managers.Names()).To(Equal([]string{"npm", "pnpm", "yarn"}))
+		})
+	})
+
+	context("Register", func() {
+		var (
+			customManager *fakes.PackageManager
+			customExec    *fakes.Executable
+		)
+
+		it.Before(func() {
+			customManager = &fakes.PackageManager{}
+			customManager.NameCall.Returns.String = "yarn"
+			customExec = &fakes.Executable{}
+		})
+
+		context("when a package manager with the same name is registered", func() {
+			it("replaces the existing package manager", func() {
+				managers.Register(customManager, customExec)
+
+				manager, ok := managers.Lookup("yarn")
+				Expect(ok).To(BeTrue())
+				Expect(manager).To(BeIdenticalTo(customManager))
+				Expect(managers.Executable("yarn")).To(BeIdenticalTo(customExec))
+				Expect(managers.Managers()).To(HaveLen(2))
+			})
+		})
+
+		context("when the fallback package manager is replaced", func() {
+			it.Before(func() {
+				customManager.NameCall.Returns.String = "npm"
+			})
+
+			it("replaces the fallback", func() {
+				managers.Register(customManager, customExec)
+
+				Expect(managers.Fallback()).To(BeIdenticalTo(customManager))
+				Expect(managers.Executable("npm")).To(BeIdenticalTo(customExec))
+				Expect(managers.Managers()).To(HaveLen(2))
+			})
+		})
+	})
+}
@@ -0,0 +1,221 @@
+package noderunscript
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NPM runs scripts with npm. It is detected by the presence of a
+// package-lock.json file.
+type NPM struct{}
+
+func NewNPM() NPM {
+	return NPM{}
+}
+
+func (n NPM) Name() string {
+	return "npm"
+}
+
+func (n NPM) Detect(workingDir string) (bool, error) {
+	return anyFileExists(workingDir, "package-lock.json")
+}
+
+func (n NPM) Requirements(workingDir string, version string) ([]string, error) {
+	return []string{"npm", "node_modules"}, nil
+}
+
+// RunArgs separates additional arguments with "--" so that npm passes them
+// through to the script rather than interpreting them itself.
+func (n NPM) RunArgs(script string, args []string) []string {
+	if len(args) == 0 {
+		return []string{"run", script}
+	}
+
+	return append([]string{"run", script, "--"}, args...)
+}
+
+func (n NPM) Env(workingDir string) ([]string, error) {
+	return nil, nil
+}
+
+func (n NPM) RunsLifecycleScripts(workingDir string, version string) (bool, error) {
+	return true, nil
+}
+
+// Yarn runs scripts with either Yarn Classic or Yarn Berry (v2+). It is
+// detected by the presence of a yarn.lock file.
+type Yarn struct{}
+
+func NewYarn() Yarn {
+	return Yarn{}
+}
+
+func (y Yarn) Name() string {
+	return "yarn"
+}
+
+func (y Yarn) Detect(workingDir string) (bool, error) {
+	return anyFileExists(workingDir, "yarn.lock")
+}
+
+// Requirements omits node_modules for Plug'n'Play projects, which resolve
+// their dependencies without a node_modules directory.
+func (y Yarn) Requirements(workingDir string, version string) ([]string, error) {
+	_, pnp, err := findYarnBerry(workingDir, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if pnp {
+		return []string{"yarn"}, nil
+	}
+
+	return []string{"yarn", "node_modules"}, nil
+}
+
+func (y Yarn) RunArgs(script string, args []string) []string {
+	return append([]string{"run", script}, args...)
+}
+
+func (y Yarn) Env(workingDir string) ([]string, error) {
+	return nil, nil
+}
+
+// RunsLifecycleScripts reports that Yarn Berry, unlike Yarn Classic, does not
+// run pre and post lifecycle scripts.
+func (y Yarn) RunsLifecycleScripts(workingDir string, version string) (bool, error) {
+	berry, _, err := findYarnBerry(workingDir, version)
+	if err != nil {
+		return false, err
+	}
+
+	return !berry, nil
+}
+
+// PNPM runs scripts with pnpm. It is detected by the presence of a
+// pnpm-lock.yaml file.
+type PNPM struct{}
+
+func NewPNPM() PNPM {
+	return PNPM{}
+}
+
+func (p PNPM) Name() string {
+	return "pnpm"
+}
+
+func (p PNPM) Detect(workingDir string) (bool, error) {
+	return anyFileExists(workingDir, "pnpm-lock.yaml")
+}
+
+func (p PNPM) Requirements(workingDir string, version string) ([]string, error) {
+	return []string{"pnpm", "node_modules"}, nil
+}
+
+func (p PNPM) RunArgs(script string, args []string) []string {
+	return append([]string{"run", script}, args...)
+}
+
+func (p PNPM) Env(workingDir string) ([]string, error) {
+	return nil, nil
+}
+
+func (p PNPM) RunsLifecycleScripts(workingDir string, version string) (bool, error) {
+	return true, nil
+}
+
+// Bun runs scripts with bun. It is detected by the presence of a bun.lock or
+// bun.lockb file.
+type Bun struct{}
+
+func NewBun() Bun {
+	return Bun{}
+}
+
+func (b Bun) Name() string {
+	return "bun"
+}
+
+func (b Bun) Detect(workingDir string) (bool, error) {
+	return anyFileExists(workingDir, "bun.lock", "bun.lockb")
+}
+
+// Requirements omits node_modules as bun projects rely on the buildpack
+// providing bun instead.
+func (b Bun) Requirements(workingDir string, version string) ([]string, error) {
+	return []string{"bun"}, nil
+}
+
+func (b Bun) RunArgs(script string, args []string) []string {
+	return append([]string{"run", script}, args...)
+}
+
+func (b Bun) Env(workingDir string) ([]string, error) {
+	return nil, nil
+}
+
+func (b Bun) RunsLifecycleScripts(workingDir string, version string) (bool, error) {
+	return true, nil
+}
+
+func anyFileExists(workingDir string, names ...string) (bool, error) {
+	for _, name := range names {
+		_, err := os.Stat(filepath.Join(workingDir, name))
+		if err == nil {
+			return true, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+	}
+
+	return false, nil
+}
+
+// findYarnBerry reports whether the project uses Yarn Berry (v2+) and, if so,
+// whether its dependencies are linked with Plug'n'Play rather than a
+// node_modules directory.
+func findYarnBerry(workingDir string, version string) (bool, bool, error) {
+	pnp, err := anyFileExists(workingDir, ".pnp.cjs")
+	if err != nil {
+		return false, false, err
+	}
+
+	if pnp {
+		return true, true, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(workingDir, ".yarnrc.yml"))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return false, false, fmt.Errorf("failed to read .yarnrc.yml: %w", err)
+		}
+
+		major, _, _ := strings.Cut(version, ".")
+		if n, err := strconv.Atoi(major); err != nil || n < 2 {
+			return false, false, nil
+		}
+
+		return true, true, nil
+	}
+
+	// Plug'n'Play is the default linker for Yarn Berry when nodeLinker is unset.
+	linker := "pnp"
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found || key != "nodeLinker" {
+			continue
+		}
+
+		value, _, _ = strings.Cut(value, "#")
+		linker = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+
+	return true, linker == "pnp", nil
+}
@@ -0,0 +1,192 @@
+package noderunscript_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	noderunscript "github.com/paketo-buildpacks/node-run-script"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPackageManagers(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		workingDir string
+	)
+
+	it.Before(func() {
+		var err error
+		workingDir, err = os.MkdirTemp("", "working-dir")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(workingDir)).To(Succeed())
+	})
+
+	context("NPM", func() {
+		var npm noderunscript.NPM
+
+		it.Before(func() {
+			npm = noderunscript.NewNPM()
+		})
+
+		it("detects a package-lock.json file", func() {
+			Expect(npm.Name()).To(Equal("npm"))
+
+			ok, err := npm.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "package-lock.json"), nil, 0600)).To(Succeed())
+
+			ok, err = npm.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		it("requires npm and node_modules", func() {
+			requirements, err := npm.Requirements(workingDir, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requirements).To(Equal([]string{"npm", "node_modules"}))
+		})
+
+		it("runs scripts with npm run", func() {
+			Expect(npm.RunArgs("build", nil)).To(Equal([]string{"run", "build"}))
+			Expect(npm.RunArgs("build", []string{"--mode", "staging"})).To(Equal([]string{"run", "build", "--", "--mode", "staging"}))
+
+			env, err := npm.Env(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(BeEmpty())
+		})
+	})
+
+	context("Yarn", func() {
+		var yarn noderunscript.Yarn
+
+		it.Before(func() {
+			yarn = noderunscript.NewYarn()
+		})
+
+		it("detects a yarn.lock file", func() {
+			Expect(yarn.Name()).To(Equal("yarn"))
+
+			ok, err := yarn.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+
+			ok, err = yarn.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		it("requires yarn and node_modules", func() {
+			requirements, err := yarn.Requirements(workingDir, "1.22.22")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requirements).To(Equal([]string{"yarn", "node_modules"}))
+		})
+
+		it("runs scripts with yarn run", func() {
+			Expect(yarn.RunArgs("build", nil)).To(Equal([]string{"run", "build"}))
+			Expect(yarn.RunArgs("build", []string{"--mode", "staging"})).To(Equal([]string{"run", "build", "--mode", "staging"}))
+		})
+
+		it("runs lifecycle scripts with yarn classic", func() {
+			runs, err := yarn.RunsLifecycleScripts(workingDir, "1.22.22")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runs).To(BeTrue())
+		})
+
+		context("when using yarn berry with a node_modules linker", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, ".yarnrc.yml"), []byte("enableTelemetry: false\nnodeLinker: 'node-modules'\n"), 0600)).To(Succeed())
+			})
+
+			it("requires yarn and node_modules", func() {
+				requirements, err := yarn.Requirements(workingDir, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requirements).To(Equal([]string{"yarn", "node_modules"}))
+			})
+		})
+
+		context("when using yarn berry with Plug'n'Play", func() {
+			it("requires only yarn", func() {
+				requirements, err := yarn.Requirements(workingDir, "4.1.0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requirements).To(Equal([]string{"yarn"}))
+			})
+
+			it("does not run lifecycle scripts", func() {
+				runs, err := yarn.RunsLifecycleScripts(workingDir, "4.1.0")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(runs).To(BeFalse())
+			})
+		})
+	})
+
+	context("PNPM", func() {
+		var pnpm noderunscript.PNPM
+
+		it.Before(func() {
+			pnpm = noderunscript.NewPNPM()
+		})
+
+		it("detects a pnpm-lock.yaml file", func() {
+			Expect(pnpm.Name()).To(Equal("pnpm"))
+
+			ok, err := pnpm.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "pnpm-lock.yaml"), nil, 0600)).To(Succeed())
+
+			ok, err = pnpm.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		it("requires pnpm and node_modules", func() {
+			requirements, err := pnpm.Requirements(workingDir, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requirements).To(Equal([]string{"pnpm", "node_modules"}))
+			Expect(pnpm.RunArgs("build", nil)).To(Equal([]string{"run", "build"}))
+			Expect(pnpm.RunArgs("build", []string{"--mode", "staging"})).To(Equal([]string{"run", "build", "--mode", "staging"}))
+		})
+	})
+
+	context("Bun", func() {
+		var bun noderunscript.Bun
+
+		it.Before(func() {
+			bun = noderunscript.NewBun()
+		})
+
+		it("detects a bun.lock or bun.lockb file", func() {
+			Expect(bun.Name()).To(Equal("bun"))
+
+			ok, err := bun.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			Expect(os.WriteFile(filepath.Join(workingDir, "bun.lockb"), nil, 0600)).To(Succeed())
+
+			ok, err = bun.Detect(workingDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+
+		it("requires only bun", func() {
+			requirements, err := bun.Requirements(workingDir, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requirements).To(Equal([]string{"bun"}))
+			Expect(bun.RunArgs("build", nil)).To(Equal([]string{"run", "build"}))
+			Expect(bun.RunArgs("build", []string{"--mode", "staging"})).To(Equal([]string{"run", "build", "--mode", "staging"}))
+		})
+	})
+}
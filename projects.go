@@ -0,0 +1,63 @@
+package noderunscript
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/paketo-buildpacks/libnodejs"
+)
+
+// project is a directory with a package.json whose scripts are run.
+type project struct {
+	// Name is the path of the project relative to the working directory, as
+	// given in BP_NODE_RUN_SCRIPTS_PROJECT_PATHS. It is empty for the single
+	// project found by libnodejs.FindProjectPath.
+	Name string
+	Dir  string
+}
+
+// findProjects returns the projects listed in
+// BP_NODE_RUN_SCRIPTS_PROJECT_PATHS or, if there are none, the project found
+// by libnodejs.FindProjectPath.
+func findProjects(workingDir string, env Environment) ([]project, error) {
+	if len(env.ProjectPaths) == 0 {
+		dir, err := libnodejs.FindProjectPath(workingDir)
+		if err != nil {
+			return nil, err
+		}
+
+		return []project{{Dir: dir}}, nil
+	}
+
+	var projects []project
+	for _, path := range env.ProjectPaths {
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("project path %q is not within the working directory", path)
+		}
+
+		dir := filepath.Join(workingDir, path)
+
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("could not find project path %q: %s", path, err)
+		}
+
+		if !info.IsDir() {
+			return nil, fmt.Errorf("project path %q is not a directory", path)
+		}
+
+		projects = append(projects, project{Name: filepath.ToSlash(filepath.Clean(path)), Dir: dir})
+	}
+
+	return projects, nil
+}
+
+// wrap names the project in the error, unless it is the only project.
+func (p project) wrap(err error) error {
+	if p.Name == "" {
+		return err
+	}
+
+	return fmt.Errorf("project %s: %w", p.Name, err)
+}
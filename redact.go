@@ -0,0 +1,155 @@
+package noderunscript
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultRedactPatterns are the environment variable name patterns whose
+// values are always masked in the build output. They only match at the end
+// of a name, so that variables such as GIT_AUTHOR_NAME or SSH_AUTH_SOCK are
+// left alone.
+var DefaultRedactPatterns = []string{"*_TOKEN", "*_SECRET", "*_PASSWORD", "*_PASSWD", "*_CREDENTIAL", "*_CREDENTIALS", "*_AUTH", "*_KEY", "*_KEY_ID", "*APIKEY"}
+
+// rcSecretPatterns are the package manager setting name patterns whose values
+// are masked in the build output. Settings such as _authToken or
+// npmAuthIdent carry no separators, so these match anywhere in a name.
+var rcSecretPatterns = []string{"*TOKEN*", "*SECRET*", "*PASSWORD*", "*PASSWD*", "*CREDENTIAL*", "*AUTH*", "*KEY*"}
+
+// minRedactLength is the length below which a secret value, whether from an
+// environment variable, a service binding or an rc file, is not masked, as
+// short values such as "1" or "true" would mask unrelated output.
+const minRedactLength = 4
+
+// RedactingWriter masks secret values in everything written to it before
+// passing it on to the underlying writer. Output that could be the start of a
+// secret is held back until the next write shows whether it is, so secrets
+// split across writes are masked as well. Flush must be called once writing
+// is done to pass on any output that is still held back.
+type RedactingWriter struct {
+	writer  io.Writer
+	secrets []string
+	pending []byte
+	m       sync.Mutex
+}
+
+// NewRedactingWriter returns a writer that replaces each of the given secrets
+// with "[REDACTED]". Empty secrets are ignored.
+func NewRedactingWriter(writer io.Writer, secrets []string) *RedactingWriter {
+	var filtered []string
+	for _, secret := range secrets {
+		if secret != "" && !slices.Contains(filtered, secret) {
+			filtered = append(filtered, secret)
+		}
+	}
+
+	// Longer secrets are matched first so that a secret containing another
+	// is masked in full.
+	slices.SortStableFunc(filtered, func(a, b string) int { return len(b) - len(a) })
+
+	return &RedactingWriter{
+		writer:  writer,
+		secrets: filtered,
+	}
+}
+
+func (w *RedactingWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.pending = append(w.pending, p...)
+	if err := w.redact(false); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush passes on any output that is held back because it could be the
+// start of a secret.
+func (w *RedactingWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.redact(true)
+}
+
+// redact writes out the pending output with every secret masked. Unless
+// final is set, it stops at the first position where the remaining output is
+// an incomplete prefix of a secret, keeping that remainder pending.
+func (w *RedactingWriter) redact(final bool) error {
+	var (
+		output bytes.Buffer
+		pos    int
+	)
+
+scan:
+	for pos < len(w.pending) {
+		rest := w.pending[pos:]
+
+		for _, secret := range w.secrets {
+			if !final && len(rest) < len(secret) && bytes.HasPrefix([]byte(secret), rest) {
+				break scan
+			}
+
+			if bytes.HasPrefix(rest, []byte(secret)) {
+				output.WriteString("[REDACTED]")
+				pos += len(secret)
+				continue scan
+			}
+		}
+
+		output.WriteByte(w.pending[pos])
+		pos++
+	}
+
+	w.pending = slices.Clone(w.pending[pos:])
+
+	if output.Len() == 0 {
+		return nil
+	}
+
+	_, err := w.writer.Write(output.Bytes())
+	return err
+}
+
+// envSecrets returns the values of the variables, in KEY=VALUE form, whose
+// names match any of the given patterns.
+func envSecrets(variables []string, patterns []string) []string {
+	var secrets []string
+	for _, variable := range variables {
+		key, value, _ := strings.Cut(variable, "=")
+		if len(value) >= minRedactLength && matchesAny(key, patterns) {
+			secrets = append(secrets, value)
+		}
+	}
+
+	return secrets
+}
+
+// redactEnv returns the variable in KEY=VALUE form with its value replaced if
+// its name matches any of the given patterns.
+func redactEnv(variable string, patterns []string) string {
+	key, _, _ := strings.Cut(variable, "=")
+	if matchesAny(key, patterns) {
+		return key + "=[REDACTED]"
+	}
+
+	return variable
+}
+
+// matchesAny reports whether the upper-cased name matches any of the
+// patterns, which are themselves matched case-insensitively.
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(name)); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+package noderunscript_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	noderunscript "github.com/paketo-buildpacks/node-run-script"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+type errorWriter struct{}
+
+func (errorWriter) Write([]byte) (int, error) {
+	return 0, errors.New("some write error")
+}
+
+func testRedactingWriter(t *testing.T, context spec.G, it spec.S) {
+	var (
+		Expect = NewWithT(t).Expect
+
+		buffer *bytes.Buffer
+		writer *noderunscript.RedactingWriter
+	)
+
+	it.Before(func() {
+		buffer = bytes.NewBuffer(nil)
+		writer = noderunscript.NewRedactingWriter(buffer, []string{"some-secret", "other-secret"})
+	})
+
+	it("masks secrets within a single write", func() {
+		n, err := writer.Write([]byte("using some-secret and other-secret, then some-secret again\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(59))
+		Expect(writer.Flush()).To(Succeed())
+
+		Expect(buffer.String()).To(Equal("using [REDACTED] and [REDACTED], then [REDACTED] again\n"))
+	})
+
+	it("passes through output without secrets as it is written", func() {
+		_, err := writer.Write([]byte("nothing to see here\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(buffer.String()).To(Equal("nothing to see here\n"))
+	})
+
+	context("when a secret is split across writes", func() {
+		it("masks the secret", func() {
+			_, err := writer.Write([]byte("token: some-se"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(Equal("token: "))
+
+			_, err = writer.Write([]byte("cret\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Flush()).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("token: [REDACTED]\n"))
+		})
+
+		it("masks the secret when it is written a byte at a time", func() {
+			for _, b := range []byte("a some-secret b other-secret c") {
+				_, err := writer.Write([]byte{b})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(buffer.String()).NotTo(ContainSubstring("some-s"))
+				Expect(buffer.String()).NotTo(ContainSubstring("other-s"))
+			}
+			Expect(writer.Flush()).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("a [REDACTED] b [REDACTED] c"))
+		})
+
+		it("masks the secret when it spans more than two writes", func() {
+			for _, chunk := range []string{"so", "me", "-", "sec", "ret!"} {
+				_, err := writer.Write([]byte(chunk))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(writer.Flush()).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("[REDACTED]!"))
+		})
+	})
+
+	context("when output only looks like the start of a secret", func() {
+		it("passes it through once the next write rules out a secret", func() {
+			_, err := writer.Write([]byte("some-sec"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(BeEmpty())
+
+			_, err = writer.Write([]byte("tion\n"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(Equal("some-section\n"))
+		})
+
+		it("passes it through when flushed", func() {
+			_, err := writer.Write([]byte("done with some-"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(Equal("done with "))
+
+			Expect(writer.Flush()).To(Succeed())
+			Expect(buffer.String()).To(Equal("done with some-"))
+		})
+
+		it("still masks a secret that starts inside the false start", func() {
+			writer = noderunscript.NewRedactingWriter(buffer, []string{"aab"})
+
+			_, err := writer.Write([]byte("aa"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = writer.Write([]byte("ab"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Flush()).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("a[REDACTED]"))
+		})
+	})
+
+	context("when one secret contains another", func() {
+		it.Before(func() {
+			writer = noderunscript.NewRedactingWriter(buffer, []string{"abc", "abcdef"})
+		})
+
+		it("masks the longer secret in full", func() {
+			_, err := writer.Write([]byte("abcdef abc abcd"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Flush()).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("[REDACTED] [REDACTED] [REDACTED]d"))
+		})
+
+		it("waits to see which secret was written", func() {
+			_, err := writer.Write([]byte("abcde"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(BeEmpty())
+
+			_, err = writer.Write([]byte("f"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(Equal("[REDACTED]"))
+		})
+
+		it("masks the shorter secret when flushed", func() {
+			_, err := writer.Write([]byte("abc"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buffer.String()).To(BeEmpty())
+
+			Expect(writer.Flush()).To(Succeed())
+			Expect(buffer.String()).To(Equal("[REDACTED]"))
+		})
+	})
+
+	context("when there are no secrets", func() {
+		it.Before(func() {
+			writer = noderunscript.NewRedactingWriter(buffer, []string{"", ""})
+		})
+
+		it("passes everything through", func() {
+			_, err := fmt.Fprint(writer, "some output")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buffer.String()).To(Equal("some output"))
+		})
+	})
+
+	context("failure cases", func() {
+		context("when the underlying writer fails", func() {
+			it.Before(func() {
+				writer = noderunscript.NewRedactingWriter(errorWriter{}, []string{"some-secret"})
+			})
+
+			it("returns the error from Write", func() {
+				_, err := writer.Write([]byte("some output"))
+				Expect(err).To(MatchError("some write error"))
+			})
+
+			it("returns the error from Flush", func() {
+				_, err := writer.Write([]byte("some-"))
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(writer.Flush()).To(MatchError("some write error"))
+			})
+		})
+	})
+}
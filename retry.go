@@ -0,0 +1,80 @@
+package noderunscript
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/chronos"
+)
+
+// RetryPolicy describes how a failing script is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times the script is run before its
+	// failure is reported. Values below 2 mean that it is not retried.
+	MaxAttempts int
+
+	// Backoff is how long to wait before the first retry. It doubles for
+	// every retry after that.
+	Backoff time.Duration
+
+	// ExitCodes restricts retries to failures with one of these exit codes.
+	// If empty, every failure is retried.
+	ExitCodes []int
+}
+
+// retryable reports whether the policy allows a retry after the given error.
+func (p RetryPolicy) retryable(err error) bool {
+	if len(p.ExitCodes) == 0 {
+		return true
+	}
+
+	code, ok := exitCode(err)
+	return ok && slices.Contains(p.ExitCodes, code)
+}
+
+// exitCode returns the exit code of the process that caused the error, if
+// any.
+func exitCode(err error) (int, bool) {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+
+	return 0, false
+}
+
+// runWithRetries calls run until it succeeds or the retry policy gives up,
+// logging the duration of each attempt when retries are enabled. It stops
+// retrying once the given context is done.
+func runWithRetries(ctx context.Context, policy RetryPolicy, clock chronos.Clock, log func(string, ...interface{}), run func() error) error {
+	attempts := max(policy.MaxAttempts, 1)
+	backoff := policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		duration, err := clock.Measure(run)
+
+		if attempts > 1 {
+			if err == nil {
+				log("Attempt %d of %d succeeded in %s", attempt, attempts, duration.Round(time.Millisecond))
+			} else {
+				log("Attempt %d of %d failed in %s: %s", attempt, attempts, duration.Round(time.Millisecond), err)
+			}
+		}
+
+		if err == nil || attempt == attempts || !policy.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		if backoff > 0 {
+			log("Retrying in %s", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			backoff *= 2
+		}
+	}
+}
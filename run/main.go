@@ -1,23 +1,33 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	noderunscript "github.com/paketo-buildpacks/node-run-script"
 	"github.com/paketo-buildpacks/packit/v2"
 	"github.com/paketo-buildpacks/packit/v2/chronos"
-	"github.com/paketo-buildpacks/packit/v2/pexec"
 	"github.com/paketo-buildpacks/packit/v2/scribe"
+	"github.com/paketo-buildpacks/packit/v2/servicebindings"
 )
 
 func main() {
-	environment := noderunscript.LoadEnvironment(os.Environ())
+	environment, err := noderunscript.LoadEnvironment(os.Environ())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	managers := noderunscript.NewPackageManagerRegistry(noderunscript.NewNPM(), noderunscript.NewProcessGroupExecutable("npm", environment.GracePeriod))
+	managers.Register(noderunscript.NewYarn(), noderunscript.NewProcessGroupExecutable("yarn", environment.GracePeriod))
+	managers.Register(noderunscript.NewPNPM(), noderunscript.NewProcessGroupExecutable("pnpm", environment.GracePeriod))
+	managers.Register(noderunscript.NewBun(), noderunscript.NewProcessGroupExecutable("bun", environment.GracePeriod))
 
 	packit.Run(
-		noderunscript.Detect(environment),
+		noderunscript.Detect(managers, environment),
 		noderunscript.Build(
-			pexec.NewExecutable("npm"),
-			pexec.NewExecutable("yarn"),
+			managers,
+			servicebindings.NewResolver(),
 			chronos.DefaultClock,
 			scribe.NewLogger(os.Stdout).WithLevel(environment.LogLevel),
 			environment,
@@ -0,0 +1,424 @@
+package noderunscript
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2/chronos"
+	"github.com/paketo-buildpacks/packit/v2/pexec"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// scriptRunner runs the scripts of a build, sharing the environment and
+// output settings between them and collecting their failures.
+type scriptRunner struct {
+	executable      Executable
+	packageManager  PackageManager
+	project         string
+	projectDir      string
+	baseEnv         []string
+	bindings        []string
+	extraEnv        []string
+	secrets         []string
+	redactPatterns  []string
+	continueOnError bool
+	clock           chronos.Clock
+	logger          scribe.Logger
+
+	// cache holds the outputs of scripts that declare them, and tools
+	// describes the package manager and Node.js versions they were built
+	// with.
+	cache *outputCache
+	tools string
+
+	m        sync.Mutex
+	failures []ScriptFailure
+	warnings []ScriptFailure
+}
+
+// run runs a single script, writing its output to the given writer and
+// reporting its progress through the given log function. A script whose
+// outputs are cached for its current inputs is not run, which is reported as
+// restored.
+func (r *scriptRunner) run(ctx context.Context, script Script, writer io.Writer, log func(string, ...interface{})) (time.Duration, bool, error) {
+	// The inherited environment is only passed explicitly when it needs to
+	// be extended.
+	var environment []string
+	if len(r.baseEnv) > 0 || len(r.bindings) > 0 || len(r.extraEnv) > 0 || len(script.Env) > 0 {
+		environment = mergeEnv(os.Environ(), r.baseEnv, r.bindings, r.extraEnv, script.Env)
+	}
+
+	scriptEnv := environment
+	if scriptEnv == nil {
+		scriptEnv = os.Environ()
+	}
+	output := NewRedactingWriter(writer, append(slices.Clone(r.secrets), envSecrets(scriptEnv, r.redactPatterns)...))
+
+	dir := r.projectDir
+	if script.Dir != "" {
+		dir = script.Dir
+	}
+
+	var fingerprint string
+	if r.cache != nil && len(script.Outputs) > 0 {
+		var err error
+		// The inherited environment differs between builds, so only the
+		// variables set for scripts are part of the fingerprint.
+		env := mergeEnv(r.baseEnv, r.bindings, r.extraEnv, script.Env)
+
+		fingerprint, err = scriptFingerprint(script, env, dir, r.projectDir, r.tools)
+		if err != nil {
+			return 0, false, err
+		}
+
+		restored, err := r.cache.restore(r.cacheKey(script), fingerprint, dir, script.Outputs)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if restored {
+			log("Restored %s from cache, skipping '%s'", strings.Join(script.Outputs, ", "), script.label())
+			return 0, true, nil
+		}
+	}
+
+	args := r.packageManager.RunArgs(script.Name, script.Args)
+	if script.Dir == "" {
+		log("Running '%s %s'", r.packageManager.Name(), quoteArgs(args))
+	} else {
+		rel, err := filepath.Rel(r.projectDir, script.Dir)
+		if err != nil {
+			rel = script.Dir
+		}
+		log("Running '%s %s' in %s", r.packageManager.Name(), quoteArgs(args), rel)
+	}
+	for _, variable := range script.Env {
+		fmt.Fprintln(output, redactEnv(variable, r.redactPatterns))
+	}
+
+	duration, err := r.clock.Measure(func() error {
+		return runWithRetries(ctx, script.Retry, r.clock, log, func() error {
+			err := execute(ctx, r.executable, script, pexec.Execution{
+				Dir:    dir,
+				Args:   args,
+				Env:    environment,
+				Stdout: output,
+				Stderr: output,
+			})
+			if flushErr := output.Flush(); err == nil {
+				err = flushErr
+			}
+
+			return err
+		})
+	})
+	if err != nil || fingerprint == "" {
+		return duration, false, err
+	}
+
+	missing, err := r.cache.save(r.cacheKey(script), fingerprint, dir, script.Outputs)
+	if err != nil {
+		return duration, false, err
+	}
+
+	if missing != "" {
+		log("Not caching the outputs of '%s': %s was not created", script.label(), missing)
+	}
+
+	return duration, false, nil
+}
+
+// cacheKey identifies the cached outputs of the script among those of every
+// project.
+func (r *scriptRunner) cacheKey(script Script) string {
+	if r.project == "" {
+		return script.label()
+	}
+
+	return r.project + ": " + script.label()
+}
+
+// record notes the failure of a script and reports whether it should stop
+// the build.
+func (r *scriptRunner) record(script Script, duration time.Duration, err error, log func(string, ...interface{})) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	failure := ScriptFailure{Name: script.label(), Project: r.project, Duration: duration, Err: err}
+	switch {
+	case script.WarnOnly:
+		log("Warning: '%s' failed: %s", script.label(), err)
+		r.warnings = append(r.warnings, failure)
+		return false
+	case r.continueOnError:
+		log("'%s' failed: %s", script.label(), err)
+		r.failures = append(r.failures, failure)
+		return false
+	default:
+		return true
+	}
+}
+
+// runSequential runs the scripts one after the other, stopping at the first
+// failure that should stop the build. Scripts whose dependencies failed are
+// not run.
+func (r *scriptRunner) runSequential(scripts []Script) error {
+	failed := map[string]bool{}
+	for _, script := range scripts {
+		if script.Skipped {
+			r.logger.Subprocess("Skipping '%s': not found in package.json", script.label())
+			continue
+		}
+
+		if dependency, ok := failedDependency(script, failed); ok {
+			r.logger.Subprocess("Skipping '%s': dependency '%s' failed", script.label(), dependency)
+			r.logger.Break()
+			failed[script.label()] = true
+			continue
+		}
+
+		duration, _, err := r.run(context.Background(), script, r.logger.ActionWriter, r.logger.Subprocess)
+		if err != nil {
+			if r.record(script, duration, err, r.logger.Subprocess) {
+				return err
+			}
+
+			failed[script.label()] = !script.WarnOnly
+		}
+
+		r.logger.Break()
+	}
+
+	return nil
+}
+
+// failedDependency returns the first dependency of the script that failed.
+// Dependencies whose failure only produces a warning do not count.
+func failedDependency(script Script, failed map[string]bool) (string, bool) {
+	for _, dependency := range script.DependsOn {
+		if failed[dependency] {
+			return dependency, true
+		}
+	}
+
+	return "", false
+}
+
+// scriptTiming is a row of the timing table logged after running scripts in
+// parallel.
+type scriptTiming struct {
+	name     string
+	status   string
+	duration time.Duration
+}
+
+// runParallel runs up to the given number of scripts at a time, starting
+// each script once its dependencies have finished. Each line of output is
+// prefixed with the name of the script that wrote it. The first failure that
+// should stop the build cancels the scripts that are still running and
+// prevents any others from starting.
+func (r *scriptRunner) runParallel(scripts []Script, concurrency int) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	width := 0
+	for _, script := range scripts {
+		width = max(width, len(script.label()))
+	}
+
+	var (
+		wg        sync.WaitGroup
+		once      sync.Once
+		firstErr  error
+		shared    = &lockedWriter{writer: r.logger.ActionWriter}
+		timings   = make([]scriptTiming, len(scripts))
+		semaphore = make(chan struct{}, max(concurrency, 1))
+
+		// done is closed once a script has finished or will not run, after
+		// which failed reports whether scripts depending on it may run.
+		done   = map[string]chan struct{}{}
+		failed sync.Map
+	)
+
+	for index, script := range scripts {
+		timings[index] = scriptTiming{name: script.label(), status: "cancelled"}
+		if script.Skipped {
+			timings[index].status = "skipped"
+		}
+		done[script.label()] = make(chan struct{})
+	}
+
+	for index, script := range scripts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[script.label()])
+
+			if script.Skipped {
+				return
+			}
+
+			output := newPrefixWriter(shared, fmt.Sprintf("[%-*s] ", width, script.label()))
+			defer func() { _ = output.Flush() }()
+
+			log := func(format string, v ...interface{}) {
+				fmt.Fprintf(output, format+"\n", v...)
+			}
+
+			for _, dependency := range script.DependsOn {
+				if _, ok := done[dependency]; !ok {
+					continue
+				}
+
+				select {
+				case <-done[dependency]:
+				case <-ctx.Done():
+					return
+				}
+
+				if _, ok := failed.Load(dependency); ok {
+					log("Skipping '%s': dependency '%s' failed", script.label(), dependency)
+					timings[index].status = "skipped"
+					failed.Store(script.label(), true)
+					return
+				}
+			}
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-semaphore }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			duration, restored, err := r.run(ctx, script, output, log)
+			timings[index].duration = duration
+
+			switch {
+			case restored:
+				timings[index].status = "cached"
+			case err == nil:
+				timings[index].status = "succeeded"
+			case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+				log("Cancelled")
+			default:
+				timings[index].status = "failed"
+				if !script.WarnOnly {
+					failed.Store(script.label(), true)
+				}
+
+				if r.record(script, duration, err, log) {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Failures are reported in the order of the scripts rather than the order
+	// in which they happened.
+	byScript := func(a, b ScriptFailure) int {
+		return slices.IndexFunc(scripts, func(s Script) bool { return s.label() == a.Name }) -
+			slices.IndexFunc(scripts, func(s Script) bool { return s.label() == b.Name })
+	}
+	slices.SortFunc(r.failures, byScript)
+	slices.SortFunc(r.warnings, byScript)
+
+	r.logger.Break()
+	r.logger.Subprocess("Script timings:")
+	for _, timing := range timings {
+		r.logger.Action("%-*s  %-10s  %s", width, timing.name, timing.duration.Round(time.Millisecond), timing.status)
+	}
+	r.logger.Break()
+
+	return firstErr
+}
+
+// lockedWriter serializes writes to the underlying writer.
+type lockedWriter struct {
+	writer io.Writer
+	m      sync.Mutex
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.writer.Write(p)
+}
+
+// prefixWriter prefixes every line written to it, passing on only complete
+// lines so that output from several writers sharing the underlying writer
+// does not interleave within a line.
+type prefixWriter struct {
+	writer  io.Writer
+	prefix  string
+	pending []byte
+	m       sync.Mutex
+}
+
+func newPrefixWriter(writer io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		writer: writer,
+		prefix: prefix,
+	}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.pending = append(w.pending, p...)
+
+	index := bytes.LastIndexByte(w.pending, '\n')
+	if index < 0 {
+		return len(p), nil
+	}
+
+	lines := strings.SplitAfter(string(w.pending[:index+1]), "\n")
+	w.pending = slices.Clone(w.pending[index+1:])
+
+	var prefixed strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			prefixed.WriteString(w.prefix + line)
+		}
+	}
+
+	if _, err := io.WriteString(w.writer, prefixed.String()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush passes on any incomplete line as a line of its own.
+func (w *prefixWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, w.prefix+string(w.pending)+"\n")
+	w.pending = nil
+
+	return err
+}
@@ -0,0 +1,156 @@
+package noderunscript
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// scriptEntry is a single entry of BP_NODE_RUN_SCRIPTS.
+type scriptEntry struct {
+	Name     string            `json:"name"`
+	Args     []string          `json:"args"`
+	Env      map[string]string `json:"env"`
+	Optional bool              `json:"optional"`
+	Timeout  duration          `json:"timeout"`
+	Retry    *retryEntry       `json:"retry"`
+	WarnOnly bool              `json:"warnOnly"`
+}
+
+// retryEntry is the retry policy of a BP_NODE_RUN_SCRIPTS entry.
+type retryEntry struct {
+	MaxAttempts int      `json:"maxAttempts"`
+	Backoff     duration `json:"backoff"`
+	ExitCodes   []int    `json:"exitCodes"`
+}
+
+// duration is a time.Duration given in JSON as a string, such as "5m".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid duration %s: expected a duration such as \"5m\"", data)
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("invalid duration %q: expected a duration such as \"5m\"", value)
+	}
+
+	*d = duration(parsed)
+	return nil
+}
+
+// parseScriptEntries parses BP_NODE_RUN_SCRIPTS, which is either a
+// comma-separated list of script names or a JSON array whose elements are
+// script names or objects with "name", "args", "env", "optional", "timeout",
+// "retry", and "warnOnly" fields.
+func parseScriptEntries(value string) ([]scriptEntry, error) {
+	if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var entries []scriptEntry
+		for _, entry := range strings.Split(value, ",") {
+			name, optional := strings.CutPrefix(strings.TrimSpace(entry), "?")
+			entries = append(entries, scriptEntry{Name: name, Optional: optional})
+		}
+
+		return entries, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(value))
+	if _, err := decoder.Token(); err != nil {
+		return nil, scriptEntriesError(err, decoder.InputOffset())
+	}
+
+	var entries []scriptEntry
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, scriptEntriesError(err, decoder.InputOffset())
+		}
+
+		entry, err := parseScriptEntry(raw)
+		if err != nil {
+			// The element ends at the current offset, so its start is found by
+			// stepping back over its raw encoding.
+			return nil, scriptEntriesError(err, decoder.InputOffset()-int64(len(raw)))
+		}
+		entries = append(entries, entry)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, scriptEntriesError(err, decoder.InputOffset())
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("unexpected data after array")
+		}
+		return nil, scriptEntriesError(err, decoder.InputOffset())
+	}
+
+	// An empty array would run nothing while still passing detection, unlike
+	// an empty BP_NODE_RUN_SCRIPTS, which turns the buildpack off.
+	if len(entries) == 0 {
+		return nil, errors.New("failed to parse BP_NODE_RUN_SCRIPTS: the array lists no scripts, leave it empty to run no scripts")
+	}
+
+	return entries, nil
+}
+
+func parseScriptEntry(raw json.RawMessage) (scriptEntry, error) {
+	switch raw[0] {
+	case '"':
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return scriptEntry{}, err
+		}
+
+		name, optional := strings.CutPrefix(name, "?")
+		if name == "" {
+			return scriptEntry{}, errors.New("script name must not be empty")
+		}
+
+		return scriptEntry{Name: name, Optional: optional}, nil
+
+	case '{':
+		var entry scriptEntry
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entry); err != nil {
+			return scriptEntry{}, err
+		}
+
+		if entry.Name == "" {
+			return scriptEntry{}, errors.New(`script object must have a "name"`)
+		}
+
+		if entry.Retry != nil && entry.Retry.MaxAttempts < 1 {
+			return scriptEntry{}, errors.New(`retry "maxAttempts" must be at least 1`)
+		}
+
+		return entry, nil
+
+	default:
+		return scriptEntry{}, fmt.Errorf("expected a script name or object, found %s", raw)
+	}
+}
+
+// scriptEntriesError reports a parse failure together with the 1-based
+// position of the offending character in BP_NODE_RUN_SCRIPTS.
+func scriptEntriesError(err error, offset int64) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset - 1
+	}
+
+	if errors.Is(err, io.EOF) {
+		err = errors.New("unexpected end of input")
+	}
+
+	return fmt.Errorf("failed to parse BP_NODE_RUN_SCRIPTS at position %d: %w", offset+1, err)
+}
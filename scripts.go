@@ -1,40 +1,430 @@
 package noderunscript
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/paketo-buildpacks/libnodejs"
 )
 
-func ScriptsToRun(workingDir string, nodeRunScripts string) ([]string, string, error) {
-	scripts := strings.Split(nodeRunScripts, ",")
-	for i := range scripts {
-		scripts[i] = strings.TrimSpace(scripts[i])
+// ErrPackageManagerMismatch is returned when the package manager pinned in
+// the package.json "packageManager" field does not match the package manager
+// detected in the project.
+var ErrPackageManagerMismatch = errors.New("package manager mismatch")
+
+// Script is a package.json script requested to run.
+type Script struct {
+	// Name is the name of the script. For a skipped pattern, it is the
+	// pattern itself.
+	Name string
+
+	// Args holds additional arguments passed through to the script.
+	Args []string
+
+	// Env holds environment variables, in KEY=VALUE form, set for the script
+	// on top of the build environment.
+	Env []string
+
+	// Timeout is how long the script may run before it is terminated. Zero
+	// means no timeout.
+	Timeout time.Duration
+
+	// Retry is the policy for retrying the script when it fails.
+	Retry RetryPolicy
+
+	// WarnOnly reports that the failure of the script is logged but does
+	// not fail the build.
+	WarnOnly bool
+
+	// DependsOn lists the scripts that must finish before this script runs.
+	// Scripts of workspace packages are given as <package>#<script>.
+	DependsOn []string
+
+	// Inputs and Outputs are the files the script reads and writes, relative
+	// to the directory of the script. Inputs may be glob patterns, while
+	// outputs are paths to files or directories.
+	// Scripts with outputs are skipped when their inputs have not changed
+	// since their outputs were cached.
+	Inputs  []string
+	Outputs []string
+
+	// Workspace is the name of the workspace package the script belongs to,
+	// and Dir is the directory of that package. Both are empty for the
+	// scripts of the project itself.
+	Workspace string
+	Dir       string
+
+	// Skipped reports that the script was optional and could not be found in
+	// package.json, so it should not be run.
+	Skipped bool
+}
+
+// label identifies the script in the build output and in the DependsOn of
+// other scripts, qualifying its name with its workspace package, if any.
+func (s Script) label() string {
+	if s.Workspace == "" {
+		return s.Name
+	}
+
+	return s.Workspace + "#" + s.Name
+}
+
+func ScriptsToRun(workingDir string, env Environment, managers *PackageManagerRegistry) ([]Script, PackageManager, string, error) {
+	pkg, err := parsePackageJSON(workingDir)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	manager, version, err := findPackageManager(workingDir, pkg, env.PackageManager, managers)
+	if err != nil {
+		return nil, nil, "", err
 	}
 
+	// Lifecycle scripts that the package manager does not run itself are only
+	// run explicitly when asked for.
+	var lifecycle bool
+	if env.RunLifecycleScripts {
+		runs, err := manager.RunsLifecycleScripts(workingDir, version)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		lifecycle = !runs
+	}
+
+	var scripts []Script
+	if env.Workspaces {
+		scripts, err = workspaceScripts(workingDir, pkg, env, lifecycle)
+	} else {
+		scripts, err = projectScripts(workingDir, pkg, env, lifecycle)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return scripts, manager, version, nil
+}
+
+// projectScripts returns the scripts to run in the given directory, along
+// with the scripts they depend on and, if lifecycle is set, their pre and
+// post lifecycle scripts.
+func projectScripts(workingDir string, pkg packageJSON, env Environment, lifecycle bool) ([]Script, error) {
 	packageJSON, err := libnodejs.ParsePackageJSON(workingDir)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	var missing []string
-	for _, script := range scripts {
-		if _, ok := packageJSON.AllScripts[script]; !ok {
-			missing = append(missing, script)
+	entries, err := parseScriptEntries(env.NodeRunScripts)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := loadScriptConfig(workingDir, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		scripts   []Script
+		missing   []string
+		unmatched []string
+	)
+
+	// scriptEnv returns the variables declared for the named script with
+	// BP_NODE_RUN_SCRIPT_ENV_<SCRIPT>_<VAR>. As script names may themselves
+	// contain underscores, each variable belongs to the longest script name
+	// in package.json that prefixes it.
+	scriptEnv := func(name string) []string {
+		var variables []string
+		for suffix, value := range env.ScriptEnv {
+			owner := ""
+			for _, script := range pkg.Scripts {
+				if len(script) > len(owner) && hasScriptEnvPrefix(suffix, script) {
+					owner = script
+				}
+			}
+
+			if owner == name {
+				variables = append(variables, suffix[len(name)+1:]+"="+value)
+			}
+		}
+		slices.Sort(variables)
+
+		return variables
+	}
+
+	// scriptTimeout returns the timeout from
+	// BP_NODE_RUN_SCRIPT_TIMEOUT_<SCRIPT>, falling back to
+	// BP_NODE_RUN_SCRIPTS_TIMEOUT.
+	scriptTimeout := func(name string) time.Duration {
+		if timeout, ok := env.ScriptTimeouts[scriptEnvName(name)]; ok {
+			return timeout
+		}
+
+		return env.Timeout
+	}
+
+	// defaultScript returns a script that was not requested in
+	// BP_NODE_RUN_SCRIPTS, such as a dependency or a lifecycle script. It
+	// shares the settings that apply to every script, but not those given in
+	// a BP_NODE_RUN_SCRIPTS entry.
+	defaultScript := func(name string) Script {
+		return Script{
+			Name:     name,
+			Env:      scriptEnv(name),
+			Timeout:  scriptTimeout(name),
+			Retry:    env.Retry,
+			WarnOnly: slices.Contains(env.WarnOnly, name),
+		}
+	}
+
+	for _, entry := range entries {
+		name, optional := entry.Name, entry.Optional || env.IfPresent
+
+		// Arguments given alongside the script in BP_NODE_RUN_SCRIPTS take
+		// precedence over BP_NODE_RUN_SCRIPT_ARGS_<SCRIPT>.
+		add := func(script Script) {
+			if !slices.ContainsFunc(scripts, func(s Script) bool { return s.Name == script.Name }) {
+				script.Args = entry.Args
+				if script.Args == nil {
+					script.Args = env.ScriptArgs[scriptEnvName(script.Name)]
+				}
+
+				script.Timeout = time.Duration(entry.Timeout)
+				if script.Timeout == 0 {
+					script.Timeout = scriptTimeout(script.Name)
+				}
+
+				script.WarnOnly = entry.WarnOnly || slices.Contains(env.WarnOnly, script.Name)
+
+				script.Retry = env.Retry
+				if entry.Retry != nil {
+					script.Retry = RetryPolicy{
+						MaxAttempts: entry.Retry.MaxAttempts,
+						Backoff:     time.Duration(entry.Retry.Backoff),
+						ExitCodes:   entry.Retry.ExitCodes,
+					}
+				}
+
+				if !script.Skipped {
+					var entryEnv []string
+					for key, value := range entry.Env {
+						entryEnv = append(entryEnv, key+"="+value)
+					}
+					slices.Sort(entryEnv)
+
+					script.Env = mergeEnv(scriptEnv(script.Name), entryEnv)
+				}
+				scripts = append(scripts, script)
+			}
+		}
+
+		if !strings.ContainsAny(name, "*?[") {
+			_, ok := packageJSON.AllScripts[name]
+			switch {
+			case ok:
+				add(Script{Name: name})
+			case optional:
+				add(Script{Name: name, Skipped: true})
+			default:
+				missing = append(missing, name)
+			}
+			continue
+		}
+
+		// Patterns expand to the matching scripts in the order in which they
+		// are declared in package.json.
+		var matched bool
+		for _, script := range pkg.Scripts {
+			ok, err := path.Match(name, script)
+			if err != nil {
+				return nil, fmt.Errorf("invalid script pattern %q: %w", name, err)
+			}
+
+			if ok {
+				matched = true
+				add(Script{Name: script})
+			}
+		}
+
+		if !matched {
+			if optional {
+				add(Script{Name: name, Skipped: true})
+			} else {
+				unmatched = append(unmatched, name)
+			}
 		}
 	}
 	if len(missing) > 0 {
-		return nil, "", fmt.Errorf("could not find script(s) %s in package.json", missing)
+		return nil, fmt.Errorf("could not find script(s) %s in package.json", missing)
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("script pattern(s) %s did not match any scripts in package.json", unmatched)
+	}
+
+	// Scripts depended on are run as well, even if they were not requested.
+	for i := 0; i < len(scripts); i++ {
+		if scripts[i].Skipped {
+			continue
+		}
+
+		scripts[i].DependsOn = slices.Clone(config.DependsOn[scripts[i].Name])
+		for _, dependency := range scripts[i].DependsOn {
+			if !slices.ContainsFunc(scripts, func(s Script) bool { return s.Name == dependency }) {
+				scripts = append(scripts, defaultScript(dependency))
+			}
+		}
+	}
+
+	// Lifecycle scripts are run explicitly to match the behavior of npm and
+	// Yarn Classic.
+	if lifecycle {
+		hook := func(name string) bool {
+			_, ok := packageJSON.AllScripts[name]
+			return ok && !slices.ContainsFunc(scripts, func(s Script) bool { return s.Name == name })
+		}
+
+		var withHooks []Script
+		for _, script := range scripts {
+			if !script.Skipped && hook("pre"+script.Name) {
+				withHooks = append(withHooks, defaultScript("pre"+script.Name))
+			}
+
+			withHooks = append(withHooks, script)
+
+			if !script.Skipped && hook("post"+script.Name) {
+				withHooks = append(withHooks, defaultScript("post"+script.Name))
+			}
+		}
+		scripts = withHooks
+
+		// A script waits for its pre lifecycle script, which in turn waits
+		// for the dependencies of the script. Its post lifecycle script
+		// waits for the script, and scripts that depend on the script
+		// wait for its post lifecycle script.
+		present := map[string]bool{}
+		for _, script := range scripts {
+			present[script.Name] = true
+		}
+
+		for i, script := range scripts {
+			if pre := "pre" + script.Name; present[pre] {
+				for j := range scripts {
+					if scripts[j].Name == pre {
+						scripts[j].DependsOn = mergeDependencies(scripts[j].DependsOn, script.DependsOn)
+					}
+				}
+				scripts[i].DependsOn = []string{pre}
+			}
+		}
+
+		for i, script := range scripts {
+			for j, dependency := range script.DependsOn {
+				if post := "post" + dependency; present[post] && post != script.Name {
+					scripts[i].DependsOn[j] = post
+				}
+			}
+
+			if main, ok := strings.CutPrefix(script.Name, "post"); ok && present[main] {
+				scripts[i].DependsOn = mergeDependencies(scripts[i].DependsOn, []string{main})
+			}
+		}
+	}
+
+	var names []string
+	dependencies := map[string][]string{}
+	for _, script := range scripts {
+		names = append(names, script.Name)
+		dependencies[script.Name] = script.DependsOn
+	}
+
+	if cycle := findCycle(names, dependencies); cycle != nil {
+		return nil, fmt.Errorf("invalid script dependencies: found a cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	for i := range scripts {
+		if cache, ok := config.Cache[scripts[i].Name]; ok && !scripts[i].Skipped {
+			scripts[i].Inputs, scripts[i].Outputs = cache.Inputs, cache.Outputs
+		}
+	}
+
+	return sortScripts(scripts), nil
+}
+
+// findPackageManager resolves the package manager and its pinned version. An
+// explicit override takes precedence, followed by the package.json
+// "packageManager" field, falling back to the first detected package manager,
+// and then to the registry fallback.
+func findPackageManager(workingDir string, pkg packageJSON, override string, managers *PackageManagerRegistry) (PackageManager, string, error) {
+	var overridden PackageManager
+	if override != "" {
+		var ok bool
+		overridden, ok = managers.Lookup(override)
+		if !ok {
+			return nil, "", fmt.Errorf("invalid package manager %q in BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER: supported package managers are %s", override, strings.Join(managers.Names(), ", "))
+		}
+	}
+
+	pinned, version, _ := strings.Cut(pkg.PackageManager, "@")
+	version, _, _ = strings.Cut(version, "+")
+
+	if overridden != nil {
+		if override != pinned {
+			return overridden, "", nil
+		}
+
+		return overridden, version, nil
+	}
+
+	var detected []string
+	for _, manager := range managers.Managers() {
+		ok, err := manager.Detect(workingDir)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if ok {
+			detected = append(detected, manager.Name())
+		}
+	}
+
+	if pinned == "" {
+		if len(detected) > 0 {
+			manager, _ := managers.Lookup(detected[0])
+			return manager, "", nil
+		}
+
+		return managers.Fallback(), "", nil
+	}
+
+	manager, ok := managers.Lookup(pinned)
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported package manager %q in package.json \"packageManager\" field", pinned)
 	}
 
-	manager := "npm"
-	_, err = os.Stat(filepath.Join(workingDir, "yarn.lock"))
-	if err == nil {
-		manager = "yarn"
+	if len(detected) > 0 && !slices.Contains(detected, pinned) {
+		return nil, "", fmt.Errorf("%w: package.json \"packageManager\" field requests %s but detected %s", ErrPackageManagerMismatch, pkg.PackageManager, strings.Join(detected, ", "))
+	}
+
+	return manager, version, nil
+}
+
+// hasScriptEnvPrefix reports whether the BP_NODE_RUN_SCRIPT_ENV_ suffix names
+// a variable of the given script.
+func hasScriptEnvPrefix(suffix, script string) bool {
+	return len(suffix) > len(script)+1 && suffix[len(script)] == '_' && scriptEnvName(suffix[:len(script)]) == scriptEnvName(script)
+}
+
+// mergeDependencies adds the dependencies that are not already listed.
+func mergeDependencies(dependencies, additional []string) []string {
+	for _, dependency := range additional {
+		if !slices.Contains(dependencies, dependency) {
+			dependencies = append(dependencies, dependency)
+		}
 	}
 
-	return scripts, manager, nil
+	return dependencies
 }
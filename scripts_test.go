@@ -4,8 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	noderunscript "github.com/paketo-buildpacks/node-run-script"
+	"github.com/paketo-buildpacks/node-run-script/fakes"
 	"github.com/sclevine/spec"
 
 	. "github.com/onsi/gomega"
@@ -16,6 +18,7 @@ func testScripts(t *testing.T, context spec.G, it spec.S) {
 		Expect = NewWithT(t).Expect
 
 		workingDir string
+		managers   *noderunscript.PackageManagerRegistry
 	)
 
 	it.Before(func() {
@@ -23,6 +26,11 @@ func testScripts(t *testing.T, context spec.G, it spec.S) {
 		workingDir, err = os.MkdirTemp("", "working-dir")
 		Expect(err).NotTo(HaveOccurred())
 
+		managers = noderunscript.NewPackageManagerRegistry(noderunscript.NewNPM(), &fakes.Executable{})
+		managers.Register(noderunscript.NewYarn(), &fakes.Executable{})
+		managers.Register(noderunscript.NewPNPM(), &fakes.Executable{})
+		managers.Register(noderunscript.NewBun(), &fakes.Executable{})
+
 		Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
 			"name": "mypackage",
 			"scripts": {
@@ -38,10 +46,11 @@ func testScripts(t *testing.T, context spec.G, it spec.S) {
 	})
 
 	it("returns a list of scripts to run and the package manager used", func() {
-		scripts, manager, err := noderunscript.ScriptsToRun(workingDir, "build")
+		scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(scripts).To(Equal([]string{"build"}))
-		Expect(manager).To(Equal("npm"))
+		Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+		Expect(manager.Name()).To(Equal("npm"))
+		Expect(version).To(BeEmpty())
 	})
 
 	context("when a yarn.lock file is present", func() {
@@ -50,34 +59,962 @@ func testScripts(t *testing.T, context spec.G, it spec.S) {
 		})
 
 		it("identifies yarn as the package manager", func() {
-			scripts, manager, err := noderunscript.ScriptsToRun(workingDir, "build")
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+			Expect(manager.Name()).To(Equal("yarn"))
+			Expect(version).To(BeEmpty())
+		})
+	})
+
+	context("when a pnpm-lock.yaml file is present", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "pnpm-lock.yaml"), nil, 0600)).To(Succeed())
+		})
+
+		it("identifies pnpm as the package manager", func() {
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+			Expect(manager.Name()).To(Equal("pnpm"))
+			Expect(version).To(BeEmpty())
+		})
+	})
+
+	context("when a bun lockfile is present", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "bun.lockb"), nil, 0600)).To(Succeed())
+		})
+
+		it("identifies bun as the package manager", func() {
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+			Expect(manager.Name()).To(Equal("bun"))
+			Expect(version).To(BeEmpty())
+		})
+	})
+
+	context("when the package.json pins a package manager", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"packageManager": "yarn@4.1.0+sha512.5b7bc055cad63273dda27df1570a5d2eb4a9f03b35b394d3d55393c2a5560a17f5cef30944b11d6a48bcbcfc1c3a26d618aae77044774c529ba36cb771ad5b0f",
+				"scripts": {
+					"build": "mybuildcommand --args"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("identifies the pinned package manager and version", func() {
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(scripts).To(Equal([]string{"build"}))
-			Expect(manager).To(Equal("yarn"))
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+			Expect(manager.Name()).To(Equal("yarn"))
+			Expect(version).To(Equal("4.1.0"))
+		})
+
+		context("when a matching lockfile is present", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+			})
+
+			it("identifies the pinned package manager and version", func() {
+				_, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manager.Name()).To(Equal("yarn"))
+				Expect(version).To(Equal("4.1.0"))
+			})
+		})
+
+		context("when the field takes precedence over a lockfile of another manager", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "pnpm@9.1.0",
+					"scripts": {
+						"build": "mybuildcommand --args"
+					}
+				}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "pnpm-lock.yaml"), nil, 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+			})
+
+			it("identifies the pinned package manager", func() {
+				_, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manager.Name()).To(Equal("pnpm"))
+				Expect(version).To(Equal("9.1.0"))
+			})
+		})
+	})
+
+	context("when using yarn berry", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"packageManager": "yarn@4.1.0",
+				"scripts": {
+					"prebuild": "myprebuildcommand --args",
+					"build": "mybuildcommand --args",
+					"postbuild": "mypostbuildcommand --args",
+					"some-script": "somecommand --args"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("leaves the lifecycle scripts out, as yarn run does", func() {
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build,some-script"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build"},
+				{Name: "some-script"},
+			}))
+			Expect(manager.Name()).To(Equal("yarn"))
+			Expect(version).To(Equal("4.1.0"))
+		})
+
+		context("when lifecycle scripts are run explicitly", func() {
+			var env noderunscript.Environment
+
+			it.Before(func() {
+				env = noderunscript.Environment{NodeRunScripts: "build,some-script", RunLifecycleScripts: true}
+			})
+
+			it("includes the pre and post lifecycle scripts", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, env, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{
+					{Name: "prebuild"},
+					{Name: "build", DependsOn: []string{"prebuild"}},
+					{Name: "postbuild", DependsOn: []string{"build"}},
+					{Name: "some-script"},
+				}))
+			})
+
+			context("when a lifecycle script is also requested explicitly", func() {
+				it("does not run it twice", func() {
+					env.NodeRunScripts = "build,postbuild"
+					scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, env, managers)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(scripts).To(Equal([]noderunscript.Script{
+						{Name: "prebuild"},
+						{Name: "build", DependsOn: []string{"prebuild"}},
+						{Name: "postbuild", DependsOn: []string{"build"}},
+					}))
+				})
+			})
+
+			context("when the version is not pinned but a .yarnrc.yml is present", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+						"scripts": {
+							"prebuild": "myprebuildcommand --args",
+							"build": "mybuildcommand --args"
+						}
+					}`), 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+					Expect(os.WriteFile(filepath.Join(workingDir, ".yarnrc.yml"), []byte("nodeLinker: node-modules\n"), 0600)).To(Succeed())
+				})
+
+				it("includes the pre and post lifecycle scripts", func() {
+					env.NodeRunScripts = "build"
+					scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, env, managers)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(scripts).To(Equal([]noderunscript.Script{{Name: "prebuild"}, {Name: "build", DependsOn: []string{"prebuild"}}}))
+				})
+			})
+		})
+
+		context("when using yarn classic", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "yarn@1.22.22",
+					"scripts": {
+						"prebuild": "myprebuildcommand --args",
+						"build": "mybuildcommand --args"
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("leaves the lifecycle scripts to yarn", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", RunLifecycleScripts: true}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+			})
+		})
+	})
+
+	context("when a registered package manager does not run lifecycle scripts", func() {
+		var customManager *fakes.PackageManager
+
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"prebuild": "myprebuildcommand --args",
+					"build": "mybuildcommand --args"
+				}
+			}`), 0600)).To(Succeed())
+
+			customManager = &fakes.PackageManager{}
+			customManager.NameCall.Returns.String = "custom"
+			customManager.DetectCall.Returns.Bool = true
+			managers.Register(customManager, &fakes.Executable{})
+		})
+
+		it("runs them explicitly when asked to", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", RunLifecycleScripts: true}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "prebuild"}, {Name: "build", DependsOn: []string{"prebuild"}}}))
+			Expect(customManager.RunsLifecycleScriptsCall.Receives.WorkingDir).To(Equal(workingDir))
+		})
+	})
+
+	context("when the package manager is overridden", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package-lock.json"), nil, 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+		})
+
+		it("uses the requested package manager regardless of lockfiles", func() {
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", PackageManager: "npm"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+			Expect(manager.Name()).To(Equal("npm"))
+			Expect(version).To(BeEmpty())
+		})
+
+		context("when the package.json pins the same package manager", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "pnpm@9.1.0",
+					"scripts": {
+						"build": "mybuildcommand --args"
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("uses the pinned version", func() {
+				_, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", PackageManager: "pnpm"}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manager.Name()).To(Equal("pnpm"))
+				Expect(version).To(Equal("9.1.0"))
+			})
+		})
+
+		context("when the package.json pins a different package manager", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "pnpm@9.1.0",
+					"scripts": {
+						"build": "mybuildcommand --args"
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("ignores the pinned version", func() {
+				_, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", PackageManager: "yarn"}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(manager.Name()).To(Equal("yarn"))
+				Expect(version).To(BeEmpty())
+			})
 		})
 	})
 
 	context("when specific scripts are requested to run", func() {
 		it("returns those scripts", func() {
-			scripts, manager, err := noderunscript.ScriptsToRun(workingDir, "some-script")
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "some-script"}, managers)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(scripts).To(Equal([]string{"some-script"}))
-			Expect(manager).To(Equal("npm"))
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "some-script"}}))
+			Expect(manager.Name()).To(Equal("npm"))
+			Expect(version).To(BeEmpty())
 		})
 	})
 
 	context("when a list of scripts is requested to run", func() {
 		it("returns those scripts", func() {
-			scripts, manager, err := noderunscript.ScriptsToRun(workingDir, "some-script, other-script")
+			scripts, manager, version, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "some-script, other-script"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "some-script"}, {Name: "other-script"}}))
+			Expect(manager.Name()).To(Equal("npm"))
+			Expect(version).To(BeEmpty())
+		})
+	})
+
+	context("when script patterns are requested to run", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"lint": "lintcommand",
+					"build:js": "jscommand",
+					"build:css": "csscommand",
+					"test": "testcommand",
+					"build:icons": "iconscommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("expands them in the order they are declared in package.json", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "lint,build:*"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "lint"}, {Name: "build:js"}, {Name: "build:css"}, {Name: "build:icons"}}))
+		})
+
+		it("does not repeat scripts that were already requested", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build:css, build:*, build:icons, b[u]ild:j?"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build:css"}, {Name: "build:js"}, {Name: "build:icons"}}))
+		})
+
+		context("when a pattern does not match any scripts", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build:*,deploy:*,release:*"}, managers)
+				Expect(err).To(MatchError("script pattern(s) [deploy:* release:*] did not match any scripts in package.json"))
+			})
+
+			context("when the pattern is marked optional", func() {
+				it("marks the pattern as skipped", func() {
+					scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build:*,?deploy:*"}, managers)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(scripts).To(Equal([]noderunscript.Script{
+						{Name: "build:js"},
+						{Name: "build:css"},
+						{Name: "build:icons"},
+						{Name: "deploy:*", Skipped: true},
+					}))
+				})
+			})
+		})
+
+		context("when a pattern is malformed", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build:["}, managers)
+				Expect(err).To(MatchError(ContainSubstring(`invalid script pattern "build:["`)))
+			})
+		})
+	})
+
+	context("when an optional script is requested to run", func() {
+		it("returns the script", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "?build"}, managers)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(scripts).To(Equal([]string{"some-script", "other-script"}))
-			Expect(manager).To(Equal("npm"))
+			Expect(scripts).To(Equal([]noderunscript.Script{{Name: "build"}}))
+		})
+
+		context("when the script is missing from the package.json", func() {
+			it("marks the script as skipped", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build, ?postbuild-assets"}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{
+					{Name: "build"},
+					{Name: "postbuild-assets", Skipped: true},
+				}))
+			})
+		})
+	})
+
+	context("when missing scripts are skipped", func() {
+		it("marks every missing script and unmatched pattern as skipped", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+				NodeRunScripts: "build,postbuild-assets,deploy:*",
+				IfPresent:      true,
+			}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build"},
+				{Name: "postbuild-assets", Skipped: true},
+				{Name: "deploy:*", Skipped: true},
+			}))
+		})
+	})
+
+	context("when arguments are given for a script", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build": "mybuildcommand",
+					"build:css": "csscommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("attaches the arguments to the script", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+				NodeRunScripts: "build,build:*",
+				ScriptArgs: map[string][]string{
+					"BUILD":     {"--mode", "staging"},
+					"BUILD_CSS": {"--minify"},
+				},
+			}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build", Args: []string{"--mode", "staging"}},
+				{Name: "build:css", Args: []string{"--minify"}},
+			}))
+		})
+	})
+
+	context("when environment variables are given for a script", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build": "mybuildcommand",
+					"build:css": "csscommand",
+					"test:smoke": "smokecommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("attaches the variables to the script they belong to", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+				NodeRunScripts: "build,build:css,test:smoke",
+				ScriptEnv: map[string]string{
+					"BUILD_NODE_ENV":      "production",
+					"BUILD_CSS_MINIFY":    "true",
+					"test_smoke_NODE_ENV": "test",
+					"LINT_NODE_ENV":       "development",
+				},
+			}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build", Env: []string{"NODE_ENV=production"}},
+				{Name: "build:css", Env: []string{"MINIFY=true"}},
+				{Name: "test:smoke", Env: []string{"NODE_ENV=test"}},
+			}))
+		})
+
+		context("when the variables are also given in a JSON array", func() {
+			it("lets the array take precedence", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+					NodeRunScripts: `[{"name": "build", "env": {"NODE_ENV": "staging", "API_URL": "https://example.com"}}]`,
+					ScriptEnv: map[string]string{
+						"BUILD_NODE_ENV": "production",
+						"BUILD_DEBUG":    "false",
+					},
+				}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{
+					{Name: "build", Env: []string{"DEBUG=false", "NODE_ENV=staging", "API_URL=https://example.com"}},
+				}))
+			})
+		})
+	})
+
+	context("when timeouts are given", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build": "mybuildcommand",
+					"build:css": "csscommand",
+					"lint": "lintcommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("attaches the most specific timeout to each script", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+				NodeRunScripts: `["build", "build:css", {"name": "lint", "timeout": "30s"}]`,
+				Timeout:        10 * time.Minute,
+				ScriptTimeouts: map[string]time.Duration{
+					"BUILD_CSS": time.Minute,
+					"LINT":      time.Hour,
+				},
+			}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build", Timeout: 10 * time.Minute},
+				{Name: "build:css", Timeout: time.Minute},
+				{Name: "lint", Timeout: 30 * time.Second},
+			}))
+		})
+
+		context("when a timeout in the JSON array is invalid", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `[{"name": "lint", "timeout": "soon"}]`}, managers)
+				Expect(err).To(MatchError(ContainSubstring(`failed to parse BP_NODE_RUN_SCRIPTS at position 2: invalid duration "soon"`)))
+			})
+		})
+	})
+
+	context("when a retry policy is given", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build": "mybuildcommand",
+					"generate": "generatecommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("lets the JSON array override the global policy", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+				NodeRunScripts: `["build", {"name": "generate", "retry": {"maxAttempts": 5, "backoff": "1s", "exitCodes": [1]}}]`,
+				Retry:          noderunscript.RetryPolicy{MaxAttempts: 2},
+			}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build", Retry: noderunscript.RetryPolicy{MaxAttempts: 2}},
+				{Name: "generate", Retry: noderunscript.RetryPolicy{MaxAttempts: 5, Backoff: time.Second, ExitCodes: []int{1}}},
+			}))
+		})
+
+		context("when the maximum number of attempts is invalid", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `[{"name": "generate", "retry": {"backoff": "1s"}}]`}, managers)
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS at position 2: retry "maxAttempts" must be at least 1`))
+			})
+		})
+	})
+
+	context("when scripts are marked as warn only", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build": "mybuildcommand",
+					"lint": "lintcommand",
+					"typecheck": "typecheckcommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("marks them in the scripts to run", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+				NodeRunScripts: `[{"name": "lint", "warnOnly": true}, "typecheck", "build"]`,
+				WarnOnly:       []string{"typecheck"},
+			}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "lint", WarnOnly: true},
+				{Name: "typecheck", WarnOnly: true},
+				{Name: "build"},
+			}))
+		})
+	})
+
+	context("when the scripts are given as a JSON array", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build": "mybuildcommand",
+					"gen, fast": "gencommand",
+					"lint": "lintcommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("returns the named scripts with their arguments", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+				NodeRunScripts: ` ["build", {"name": "gen, fast", "args": ["--fast"]}, {"name": "docs", "optional": true}, "lint"]`,
+				ScriptArgs: map[string][]string{
+					"GEN__FAST": {"--slow"},
+					"LINT":      {"--fix"},
+				},
+			}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build"},
+				{Name: "gen, fast", Args: []string{"--fast"}},
+				{Name: "docs", Skipped: true},
+				{Name: "lint", Args: []string{"--fix"}},
+			}))
+		})
+
+		context("when the array is malformed", func() {
+			it("returns an error pointing at the offending position", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `["build" "lint"]`}, managers)
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS at position 10: invalid character '"' after array element`))
+			})
+		})
+
+		context("when the array is not terminated", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `["build",`}, managers)
+				Expect(err).To(MatchError("failed to parse BP_NODE_RUN_SCRIPTS at position 9: unexpected end of JSON input"))
+			})
+		})
+
+		context("when an entry is not a name or object", func() {
+			it("returns an error pointing at the entry", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `["build", 42]`}, managers)
+				Expect(err).To(MatchError("failed to parse BP_NODE_RUN_SCRIPTS at position 11: expected a script name or object, found 42"))
+			})
+		})
+
+		context("when an object has no name", func() {
+			it("returns an error pointing at the entry", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `["build", {"args": ["--fast"]}]`}, managers)
+				Expect(err).To(MatchError(`failed to parse BP_NODE_RUN_SCRIPTS at position 11: script object must have a "name"`))
+			})
+		})
+
+		context("when an object has an unknown field", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `[{"name": "build", "arguments": []}]`}, managers)
+				Expect(err).To(MatchError(ContainSubstring(`failed to parse BP_NODE_RUN_SCRIPTS at position 2: json: unknown field "arguments"`)))
+			})
+		})
+
+		context("when the array is empty", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: ` [ ] `}, managers)
+				Expect(err).To(MatchError("failed to parse BP_NODE_RUN_SCRIPTS: the array lists no scripts, leave it empty to run no scripts"))
+			})
+		})
+
+		context("when there is data after the array", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: `["build"] lint`}, managers)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse BP_NODE_RUN_SCRIPTS at position 11")))
+			})
+		})
+	})
+
+	context("when dependencies between scripts are declared", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"codegen": "codegencommand",
+					"build:js": "buildjscommand",
+					"build:css": "buildcsscommand",
+					"bundle": "bundlecommand"
+				},
+				"paketo": {
+					"dependsOn": {
+						"build:js": ["codegen"],
+						"build:css": ["codegen"],
+						"bundle": ["build:js", "build:css"]
+					}
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("orders the scripts after their dependencies and adds those not requested", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "bundle,build:css"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "codegen"},
+				{Name: "build:js", DependsOn: []string{"codegen"}},
+				{Name: "build:css", DependsOn: []string{"codegen"}},
+				{Name: "bundle", DependsOn: []string{"build:js", "build:css"}},
+			}))
+		})
+
+		context("when they are declared in a config file", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"dependsOn": {
+						"bundle": ["build:css"]
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("lets the config file take precedence", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "bundle"}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{
+					{Name: "build:css"},
+					{Name: "bundle", DependsOn: []string{"build:css"}},
+				}))
+			})
+		})
+
+		context("when the config file is malformed", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte("%%%"), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "bundle"}, managers)
+				Expect(err).To(MatchError(ContainSubstring("failed to parse node-run-script.json: invalid character '%'")))
+			})
+		})
+
+		context("when a declared script is missing from the package.json", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"dependsOn": {
+						"test": ["bundle"]
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "bundle"}, managers)
+				Expect(err).To(MatchError(`invalid script dependencies in node-run-script.json: script "test" is not in package.json`))
+			})
+		})
+
+		context("when using yarn berry", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "yarn@4.1.0",
+					"scripts": {
+						"codegen": "codegencommand",
+						"postcodegen": "postcodegencommand",
+						"prebuild": "prebuildcommand",
+						"build": "buildcommand"
+					},
+					"paketo": {
+						"dependsOn": {
+							"build": ["codegen"]
+						}
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("runs the lifecycle scripts between the script and its dependencies", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", RunLifecycleScripts: true}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{
+					{Name: "codegen"},
+					{Name: "postcodegen", DependsOn: []string{"codegen"}},
+					{Name: "prebuild", DependsOn: []string{"postcodegen"}},
+					{Name: "build", DependsOn: []string{"prebuild"}},
+				}))
+			})
+		})
+	})
+
+	context("when the cached outputs of scripts are declared", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"scripts": {
+					"build": "buildcommand",
+					"lint": "lintcommand"
+				}
+			}`), 0600)).To(Succeed())
+		})
+
+		it("sets the inputs and outputs of the scripts", func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+				"cache": {"build": {"inputs": ["src/**/*.ts", "tsconfig.json"], "outputs": ["dist"]}}
+			}`), 0600)).To(Succeed())
+
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "lint,build"}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "lint"},
+				{Name: "build", Inputs: []string{"src/**/*.ts", "tsconfig.json"}, Outputs: []string{"dist"}},
+			}))
+		})
+
+		context("when a script declares no outputs", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"cache": {"build": {"inputs": ["src"]}}
+				}`), 0600)).To(Succeed())
+
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(`invalid script cache in node-run-script.json: script "build" declares no outputs`))
+			})
+		})
+
+		context("when an output is outside of the project", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"cache": {"build": {"inputs": ["src"], "outputs": ["../dist"]}}
+				}`), 0600)).To(Succeed())
+
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(`invalid script cache in node-run-script.json: output "../dist" of script "build" is not within the project`))
+			})
+		})
+
+		context("when a script declares no inputs", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"cache": {"build": {"outputs": ["dist"]}}
+				}`), 0600)).To(Succeed())
+
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(`invalid script cache in node-run-script.json: script "build" declares no inputs`))
+			})
+		})
+
+		context("when an output is the project itself", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"cache": {"build": {"inputs": ["src"], "outputs": ["dist/.."]}}
+				}`), 0600)).To(Succeed())
+
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(`invalid script cache in node-run-script.json: output "dist/.." of script "build" is the project itself`))
+			})
+		})
+
+		context("when an output contains an input", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"cache": {"build": {"inputs": ["src/**/*.ts"], "outputs": ["src"]}}
+				}`), 0600)).To(Succeed())
+
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(`invalid script cache in node-run-script.json: output "src" of script "build" contains its input "src/**/*.ts"`))
+			})
+		})
+
+		context("when an output is a glob pattern", func() {
+			it("returns an error", func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, noderunscript.ScriptConfigFile), []byte(`{
+					"cache": {"build": {"inputs": ["src/**/*.ts"], "outputs": ["dist/*.js"]}}
+				}`), 0600)).To(Succeed())
+
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(`invalid script cache in node-run-script.json: output "dist/*.js" of script "build" must be a path, not a glob pattern`))
+			})
+		})
+	})
+
+	context("when running the scripts of workspace packages", func() {
+		it.Before(func() {
+			Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+				"name": "monorepo",
+				"workspaces": ["packages/*"]
+			}`), 0600)).To(Succeed())
+
+			for dir, content := range map[string]string{
+				"packages/ui":   `{"name": "@acme/ui", "scripts": {"build": "tsc"}}`,
+				"packages/web":  `{"name": "@acme/web", "scripts": {"build": "next build"}, "dependencies": {"@acme/ui": "*", "react": "^19.0.0"}}`,
+				"packages/docs": `{"name": "@acme/docs", "devDependencies": {"@acme/web": "*"}}`,
+				"tools/lint":    `{"name": "@acme/lint", "scripts": {"build": "tsc"}}`,
+			} {
+				Expect(os.MkdirAll(filepath.Join(workingDir, dir), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, dir, "package.json"), []byte(content), 0600)).To(Succeed())
+			}
+		})
+
+		it("returns the scripts of each package after those of its dependencies", func() {
+			scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", Workspaces: true}, managers)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(scripts).To(Equal([]noderunscript.Script{
+				{Name: "build", Workspace: "@acme/ui", Dir: filepath.Join(workingDir, "packages", "ui")},
+				{Name: "build", Workspace: "@acme/web", Dir: filepath.Join(workingDir, "packages", "web"), DependsOn: []string{"@acme/ui#build"}},
+			}))
+		})
+
+		context("when the workspace is declared in pnpm-workspace.yaml", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "pnpm-workspace.yaml"), []byte(`packages:
+  # every tool but the linter
+  - "tools/**"
+  - '!tools/lint'
+  - packages/ui
+catalog:
+  react: ^19.0.0
+`), 0600)).To(Succeed())
+			})
+
+			it("uses the packages it lists", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", Workspaces: true}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{
+					{Name: "build", Workspace: "@acme/ui", Dir: filepath.Join(workingDir, "packages", "ui")},
+				}))
+			})
+		})
+
+		context("when the packages are filtered", func() {
+			it("only returns the scripts of the matching packages", func() {
+				scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+					NodeRunScripts:  "build",
+					Workspaces:      true,
+					WorkspaceFilter: []string{"@acme/w*"},
+				}, managers)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(scripts).To(Equal([]noderunscript.Script{
+					{Name: "build", Workspace: "@acme/web", Dir: filepath.Join(workingDir, "packages", "web")},
+				}))
+			})
+
+			context("when the filter includes dependencies", func() {
+				it("returns the scripts of their dependencies too", func() {
+					scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+						NodeRunScripts:  "build",
+						Workspaces:      true,
+						WorkspaceFilter: []string{"@acme/docs..."},
+					}, managers)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(scripts).To(HaveLen(2))
+					Expect(scripts[1].Workspace).To(Equal("@acme/web"))
+				})
+			})
+
+			context("when the filter leaves out a package between two others", func() {
+				it.Before(func() {
+					Expect(os.WriteFile(filepath.Join(workingDir, "packages", "docs", "package.json"), []byte(`{
+						"name": "@acme/docs",
+						"scripts": {"build": "vitepress build"},
+						"devDependencies": {"@acme/web": "*"}
+					}`), 0600)).To(Succeed())
+				})
+
+				it("keeps the ordering through the package left out", func() {
+					scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+						NodeRunScripts:  "build",
+						Workspaces:      true,
+						WorkspaceFilter: []string{"@acme/docs", "@acme/ui"},
+					}, managers)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(scripts).To(Equal([]noderunscript.Script{
+						{Name: "build", Workspace: "@acme/ui", Dir: filepath.Join(workingDir, "packages", "ui")},
+						{Name: "build", Workspace: "@acme/docs", Dir: filepath.Join(workingDir, "packages", "docs"), DependsOn: []string{"@acme/ui#build"}},
+					}))
+				})
+			})
+
+			context("when the filter matches no packages", func() {
+				it("returns an error", func() {
+					_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{
+						NodeRunScripts:  "build",
+						Workspaces:      true,
+						WorkspaceFilter: []string{"@other/*"},
+					}, managers)
+					Expect(err).To(MatchError(`workspace filter "@other/*" did not match any packages`))
+				})
+			})
+		})
+
+		context("when no package declares a requested script", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build,buidl", Workspaces: true}, managers)
+				Expect(err).To(MatchError("could not find script(s) [buidl] in any workspace package"))
+			})
+
+			context("when the script is optional", func() {
+				it("skips it", func() {
+					scripts, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build,?buidl", Workspaces: true}, managers)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(scripts).To(HaveLen(2))
+				})
+			})
+		})
+
+		context("when the packages depend on each other in a cycle", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "packages", "ui", "package.json"), []byte(`{
+					"name": "@acme/ui",
+					"dependencies": {"@acme/docs": "*"}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", Workspaces: true}, managers)
+				Expect(err).To(MatchError("workspace packages depend on each other in a cycle: @acme/docs -> @acme/web -> @acme/ui -> @acme/docs"))
+			})
+		})
+
+		context("when no workspace packages are declared", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{"name": "monorepo"}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", Workspaces: true}, managers)
+				Expect(err).To(MatchError(`no workspace packages declared in pnpm-workspace.yaml or the package.json "workspaces" field`))
+			})
 		})
 	})
 
 	context("when a requested script is missing from the package.json", func() {
 		it("returns an error", func() {
-			_, _, err := noderunscript.ScriptsToRun(workingDir, "missing-script")
+			_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "missing-script"}, managers)
 			Expect(err).To(MatchError(`could not find script(s) [missing-script] in package.json`))
 		})
 	})
@@ -89,18 +1026,59 @@ func testScripts(t *testing.T, context spec.G, it spec.S) {
 			})
 
 			it("returns an error", func() {
-				_, _, err := noderunscript.ScriptsToRun(workingDir, "some-script")
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "some-script"}, managers)
 				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
 			})
 		})
 
+		context("when the pinned package manager does not match the lockfile", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "pnpm@9.1.0",
+					"scripts": {
+						"build": "mybuildcommand --args"
+					}
+				}`), 0600)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(workingDir, "yarn.lock"), nil, 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(noderunscript.ErrPackageManagerMismatch))
+				Expect(err).To(MatchError(ContainSubstring(`package.json "packageManager" field requests pnpm@9.1.0 but detected yarn`)))
+			})
+		})
+
+		context("when the pinned package manager is not supported", func() {
+			it.Before(func() {
+				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte(`{
+					"packageManager": "cnpm@1.0.0",
+					"scripts": {
+						"build": "mybuildcommand --args"
+					}
+				}`), 0600)).To(Succeed())
+			})
+
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build"}, managers)
+				Expect(err).To(MatchError(`unsupported package manager "cnpm" in package.json "packageManager" field`))
+			})
+		})
+
+		context("when the package manager override is invalid", func() {
+			it("returns an error", func() {
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "build", PackageManager: "cnpm"}, managers)
+				Expect(err).To(MatchError(`invalid package manager "cnpm" in BP_NODE_RUN_SCRIPTS_PACKAGE_MANAGER: supported package managers are bun, npm, pnpm, yarn`))
+			})
+		})
+
 		context("when the package.json file is malformed", func() {
 			it.Before(func() {
 				Expect(os.WriteFile(filepath.Join(workingDir, "package.json"), []byte("%%%"), 0600)).To(Succeed())
 			})
 
 			it("returns an error", func() {
-				_, _, err := noderunscript.ScriptsToRun(workingDir, "some-script")
+				_, _, _, err := noderunscript.ScriptsToRun(workingDir, noderunscript.Environment{NodeRunScripts: "some-script"}, managers)
 				Expect(err).To(MatchError(ContainSubstring("invalid character '%'")))
 			})
 		})
@@ -0,0 +1,372 @@
+package noderunscript
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/paketo-buildpacks/packit/v2"
+	"github.com/paketo-buildpacks/packit/v2/chronos"
+	packitfs "github.com/paketo-buildpacks/packit/v2/fs"
+	"github.com/paketo-buildpacks/packit/v2/scribe"
+)
+
+// ToolCacheLayer is the name of the cache layer holding the caches of build
+// tools such as webpack, Babel, Next.js and Angular.
+const ToolCacheLayer = "tool-caches"
+
+// DefaultToolCacheLimit is the total size, in bytes, of the cached tool
+// directories unless configured otherwise.
+const DefaultToolCacheLimit = 1 << 30
+
+// knownToolCaches lists the cache directories of known tools, relative to a
+// package, along with the dependencies that show the package uses the tool.
+// Directories without dependencies are cached whenever they exist.
+var knownToolCaches = []struct {
+	Path         string
+	Dependencies []string
+}{
+	{Path: "node_modules/.cache"},
+	{Path: ".next/cache", Dependencies: []string{"next"}},
+	{Path: ".angular/cache", Dependencies: []string{"@angular/cli", "@angular/core"}},
+	{Path: ".parcel-cache", Dependencies: []string{"parcel"}},
+}
+
+// toolCache keeps the cache directories of build tools in a cache layer
+// between builds. Once their total size exceeds the limit, the directories
+// used least recently are evicted.
+type toolCache struct {
+	layer    packit.Layer
+	patterns []string
+	limit    int64
+	clock    chronos.Clock
+	logger   scribe.Logger
+
+	saved []toolCacheEntry
+}
+
+// toolCacheEntry is a cached directory.
+type toolCacheEntry struct {
+	Project string
+	Path    string
+	Size    int64
+	Used    time.Time
+
+	// source is the directory to cache, for entries saved by this build.
+	source string
+}
+
+// key identifies the entry in the layer metadata and in the build output.
+func (e toolCacheEntry) key() string {
+	return path.Join(e.Project, e.Path)
+}
+
+// newToolCache returns the tool cache held by the ToolCacheLayer.
+func newToolCache(layers packit.Layers, env Environment, clock chronos.Clock, logger scribe.Logger) (*toolCache, error) {
+	layer, err := layers.Get(ToolCacheLayer)
+	if err != nil {
+		return nil, err
+	}
+	layer.Cache = true
+
+	limit := env.ToolCacheLimit
+	if limit == 0 {
+		limit = DefaultToolCacheLimit
+	}
+
+	return &toolCache{
+		layer:    layer,
+		patterns: env.ToolCaches,
+		limit:    limit,
+		clock:    clock,
+		logger:   logger,
+	}, nil
+}
+
+// entryDir returns the directory of the layer holding the cached directory.
+func (c *toolCache) entryDir(entry toolCacheEntry) string {
+	sum := sha256.Sum256([]byte(entry.key()))
+	return filepath.Join(c.layer.Path, hex.EncodeToString(sum[:8]))
+}
+
+// entries returns the cached directories recorded in the layer metadata.
+func (c *toolCache) entries() []toolCacheEntry {
+	var entries []toolCacheEntry
+	for _, value := range c.layer.Metadata {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var entry toolCacheEntry
+		entry.Project, _ = fields["project"].(string)
+		entry.Path, _ = fields["path"].(string)
+		entry.Size, _ = fields["size"].(int64)
+		if used, ok := fields["used"].(string); ok {
+			entry.Used, _ = time.Parse(time.RFC3339, used)
+		}
+
+		if entry.Path != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b toolCacheEntry) int {
+		return cmp.Compare(a.key(), b.key())
+	})
+
+	return entries
+}
+
+// restore copies the cached directories of the project into the project
+// directory, leaving directories that already exist alone. It returns the
+// restored directories.
+func (c *toolCache) restore(project string, projectDir string) ([]string, error) {
+	var restored []string
+	for _, entry := range c.entries() {
+		if entry.Project != project {
+			continue
+		}
+
+		destination := filepath.Join(projectDir, filepath.FromSlash(entry.Path))
+		if _, err := os.Lstat(destination); err == nil {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to restore tool cache %s: %w", entry.Path, err)
+		}
+
+		if err := packitfs.Copy(c.entryDir(entry), destination); err != nil {
+			return nil, fmt.Errorf("failed to restore tool cache %s: %w", entry.Path, err)
+		}
+
+		restored = append(restored, entry.Path)
+	}
+
+	return restored, nil
+}
+
+// find returns the cache directories, relative to the project directory, of
+// the known tools used by the packages in the given directories and those
+// matching the configured patterns.
+func (c *toolCache) find(projectDir string, dirs []string) ([]string, error) {
+	var found []string
+	add := func(dir string) error {
+		rel, err := filepath.Rel(projectDir, dir)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(found, filepath.ToSlash(rel)) {
+			found = append(found, filepath.ToSlash(rel))
+		}
+
+		return nil
+	}
+
+	for _, dir := range dirs {
+		pkg, err := parsePackageJSON(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		for _, known := range knownToolCaches {
+			used := len(known.Dependencies) == 0
+			for _, dependency := range known.Dependencies {
+				for _, deps := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.PeerDependencies, pkg.OptionalDependencies} {
+					_, ok := deps[dependency]
+					used = used || ok
+				}
+			}
+
+			cacheDir := filepath.Join(dir, filepath.FromSlash(known.Path))
+			if info, err := os.Stat(cacheDir); used && err == nil && info.IsDir() {
+				if err := add(cacheDir); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if len(c.patterns) == 0 {
+		return found, nil
+	}
+
+	// Dependencies are only searched by patterns that name node_modules.
+	searchModules := slices.ContainsFunc(c.patterns, func(pattern string) bool {
+		return strings.Contains(pattern, "node_modules")
+	})
+
+	err := filepath.WalkDir(projectDir, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() || dir == projectDir {
+			return nil
+		}
+
+		if entry.Name() == ".git" || (entry.Name() == "node_modules" && !searchModules) {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(projectDir, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, pattern := range c.patterns {
+			if matchGlob(pattern, filepath.ToSlash(rel)) {
+				if err := add(dir); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tool caches: %w", err)
+	}
+
+	return found, nil
+}
+
+// collect notes the cache directories of the project to save once every
+// project has been built.
+func (c *toolCache) collect(project, projectDir string, paths []string) error {
+	for _, rel := range paths {
+		source := filepath.Join(projectDir, filepath.FromSlash(rel))
+
+		size, err := dirSize(source)
+		if err != nil {
+			return fmt.Errorf("failed to measure tool cache %s: %w", rel, err)
+		}
+
+		c.saved = append(c.saved, toolCacheEntry{
+			Project: project,
+			Path:    rel,
+			Size:    size,
+			Used:    c.clock.Now(),
+			source:  source,
+		})
+	}
+
+	return nil
+}
+
+// finish saves the collected directories into the layer and returns it. The
+// directories used most recently are kept first, and those that no longer
+// fit within the limit are evicted or not saved.
+func (c *toolCache) finish() (packit.Layer, error) {
+	entries := slices.Clone(c.saved)
+	for _, entry := range c.entries() {
+		if !slices.ContainsFunc(c.saved, func(saved toolCacheEntry) bool { return saved.key() == entry.key() }) {
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortStableFunc(entries, func(a, b toolCacheEntry) int {
+		return b.Used.Compare(a.Used)
+	})
+
+	var (
+		total int64
+		saved []string
+	)
+	metadata := map[string]interface{}{}
+	for _, entry := range entries {
+		if total+entry.Size > c.limit {
+			if entry.source != "" {
+				c.logger.Subprocess("Not caching %s: it would exceed the tool cache limit of %s", entry.key(), formatSize(c.limit))
+			} else {
+				c.logger.Subprocess("Evicting %s from the tool cache", entry.key())
+			}
+
+			if err := os.RemoveAll(c.entryDir(entry)); err != nil {
+				return packit.Layer{}, fmt.Errorf("failed to evict tool cache %s: %w", entry.key(), err)
+			}
+			continue
+		}
+
+		if entry.source != "" {
+			if err := os.RemoveAll(c.entryDir(entry)); err != nil {
+				return packit.Layer{}, fmt.Errorf("failed to save tool cache %s: %w", entry.key(), err)
+			}
+
+			if err := os.MkdirAll(c.layer.Path, os.ModePerm); err != nil {
+				return packit.Layer{}, fmt.Errorf("failed to save tool cache %s: %w", entry.key(), err)
+			}
+
+			if err := packitfs.Copy(entry.source, c.entryDir(entry)); err != nil {
+				return packit.Layer{}, fmt.Errorf("failed to save tool cache %s: %w", entry.key(), err)
+			}
+
+			saved = append(saved, fmt.Sprintf("%s (%s)", entry.key(), formatSize(entry.Size)))
+		}
+
+		total += entry.Size
+		metadata[entry.key()] = map[string]interface{}{
+			"project": entry.Project,
+			"path":    entry.Path,
+			"size":    entry.Size,
+			"used":    entry.Used.Format(time.RFC3339),
+		}
+	}
+
+	if len(saved) > 0 {
+		c.logger.Subprocess("Saved tool caches: %s", strings.Join(saved, ", "))
+		c.logger.Break()
+	}
+
+	c.layer.Metadata = metadata
+
+	return c.layer, nil
+}
+
+// dirSize returns the total size of the regular files in the directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
+
+// formatSize formats a size in bytes using binary units.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value, exponent := float64(size)/unit, 0
+	for value >= unit && exponent < 2 {
+		value /= unit
+		exponent++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", value, "KMG"[exponent])
+}
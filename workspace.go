@@ -0,0 +1,376 @@
+package noderunscript
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// workspacePackage is a package of a workspace.
+type workspacePackage struct {
+	Name string
+	Dir  string
+
+	// Dependencies lists the other packages of the workspace that the package
+	// depends on.
+	Dependencies []string
+}
+
+// workspaceScripts returns the scripts to run in every package of the
+// workspace. The scripts of a package depend on those of the packages it
+// depends on, and packages without the requested scripts are left out.
+func workspaceScripts(workingDir string, pkg packageJSON, env Environment, lifecycle bool) ([]Script, error) {
+	packages, err := findWorkspacePackages(workingDir, pkg, env.WorkspaceFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseScriptEntries(env.NodeRunScripts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Not every package needs to declare every script, but each script that
+	// is not optional must be declared by at least one package.
+	var required []string
+	for _, entry := range entries {
+		if !entry.Optional && !env.IfPresent {
+			required = append(required, entry.Name)
+		}
+	}
+	env.IfPresent = true
+
+	var (
+		scripts []Script
+
+		// finals holds the scripts that the dependents of each package wait
+		// for. A package without scripts passes on those of its own
+		// dependencies.
+		finals = map[string][]string{}
+	)
+
+	for _, workspace := range packages {
+		var waitFor []string
+		for _, dependency := range workspace.Dependencies {
+			waitFor = mergeDependencies(waitFor, finals[dependency])
+		}
+
+		workspacePkg, err := parsePackageJSON(workspace.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("workspace package %q: %w", workspace.Name, err)
+		}
+
+		packageScripts, err := projectScripts(workspace.Dir, workspacePkg, env, lifecycle)
+		if err != nil {
+			return nil, fmt.Errorf("workspace package %q: %w", workspace.Name, err)
+		}
+
+		var labels []string
+		for _, script := range packageScripts {
+			if script.Skipped {
+				continue
+			}
+
+			var dependsOn []string
+			for _, dependency := range script.DependsOn {
+				dependsOn = append(dependsOn, workspace.Name+"#"+dependency)
+			}
+
+			script.Workspace, script.Dir = workspace.Name, workspace.Dir
+			script.DependsOn = mergeDependencies(dependsOn, waitFor)
+			scripts = append(scripts, script)
+			labels = append(labels, script.label())
+		}
+
+		finals[workspace.Name] = labels
+		if len(labels) == 0 {
+			finals[workspace.Name] = waitFor
+		}
+	}
+
+	var missing []string
+	for _, name := range required {
+		found := slices.ContainsFunc(scripts, func(script Script) bool {
+			ok, _ := path.Match(name, script.Name)
+			return ok
+		})
+
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("could not find script(s) %s in any workspace package", missing)
+	}
+
+	return sortScripts(scripts), nil
+}
+
+// findWorkspacePackages returns the packages of the workspace declared in
+// pnpm-workspace.yaml or in the package.json "workspaces" field, ordered so
+// that each package comes after the packages it depends on. A filter selects
+// packages by name, and a pattern ending in "..." selects their dependencies
+// too.
+func findWorkspacePackages(workingDir string, pkg packageJSON, filter []string) ([]workspacePackage, error) {
+	patterns, err := parsePnpmWorkspace(workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if patterns == nil {
+		patterns = pkg.Workspaces
+	}
+
+	if len(patterns) == 0 {
+		return nil, errors.New(`no workspace packages declared in pnpm-workspace.yaml or the package.json "workspaces" field`)
+	}
+
+	var found []workspacePackage
+	err = filepath.WalkDir(workingDir, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() || dir == workingDir {
+			return nil
+		}
+
+		if entry.Name() == "node_modules" || strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(workingDir, dir)
+		if err != nil {
+			return err
+		}
+
+		if !matchesWorkspacePatterns(patterns, filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		workspacePkg, err := parsePackageJSON(dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		name := workspacePkg.Name
+		if name == "" {
+			name = filepath.ToSlash(rel)
+		}
+
+		var dependencies []string
+		for _, deps := range []map[string]string{workspacePkg.Dependencies, workspacePkg.DevDependencies, workspacePkg.PeerDependencies, workspacePkg.OptionalDependencies} {
+			dependencies = mergeDependencies(dependencies, slices.Sorted(maps.Keys(deps)))
+		}
+
+		found = append(found, workspacePackage{Name: name, Dir: dir, Dependencies: dependencies})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find workspace packages: %w", err)
+	}
+
+	packages := map[string]workspacePackage{}
+	for _, workspace := range found {
+		if _, ok := packages[workspace.Name]; ok {
+			return nil, fmt.Errorf("found more than one workspace package named %q", workspace.Name)
+		}
+		packages[workspace.Name] = workspace
+	}
+
+	// Only dependencies on other packages of the workspace are of interest.
+	graph := map[string][]string{}
+	for name, workspace := range packages {
+		workspace.Dependencies = slices.DeleteFunc(workspace.Dependencies, func(dependency string) bool {
+			_, ok := packages[dependency]
+			return !ok
+		})
+		slices.Sort(workspace.Dependencies)
+		packages[name] = workspace
+		graph[name] = workspace.Dependencies
+	}
+
+	names := slices.Sorted(maps.Keys(packages))
+	if cycle := findCycle(names, graph); cycle != nil {
+		return nil, fmt.Errorf("workspace packages depend on each other in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	if len(filter) > 0 {
+		selected := map[string]bool{}
+		var selectWithDependencies func(name string)
+		selectWithDependencies = func(name string) {
+			selected[name] = true
+			for _, dependency := range graph[name] {
+				selectWithDependencies(dependency)
+			}
+		}
+
+		for _, pattern := range filter {
+			pattern, withDependencies := strings.CutSuffix(pattern, "...")
+
+			var matched bool
+			for _, name := range names {
+				if ok, _ := path.Match(pattern, name); ok {
+					matched = true
+					selected[name] = true
+					if withDependencies {
+						selectWithDependencies(name)
+					}
+				}
+			}
+
+			if !matched {
+				return nil, fmt.Errorf("workspace filter %q did not match any packages", pattern)
+			}
+		}
+
+		names = slices.DeleteFunc(names, func(name string) bool { return !selected[name] })
+	}
+
+	// Packages are ordered by their depth in the dependency graph, so that
+	// each level only depends on the levels before it.
+	levels := map[string]int{}
+	var level func(name string) int
+	level = func(name string) int {
+		if l, ok := levels[name]; ok {
+			return l
+		}
+
+		l := 0
+		for _, dependency := range graph[name] {
+			l = max(l, level(dependency)+1)
+		}
+		levels[name] = l
+
+		return l
+	}
+
+	slices.SortStableFunc(names, func(a, b string) int {
+		return cmp.Compare(level(a), level(b))
+	})
+
+	// A package left out by the filter still orders the selected packages
+	// around it, so each package depends on the nearest selected packages
+	// it reaches through its dependencies.
+	var selectedDependencies func(name string) []string
+	selectedDependencies = func(name string) []string {
+		var dependencies []string
+		for _, dependency := range graph[name] {
+			if slices.Contains(names, dependency) {
+				dependencies = mergeDependencies(dependencies, []string{dependency})
+			} else {
+				dependencies = mergeDependencies(dependencies, selectedDependencies(dependency))
+			}
+		}
+		slices.Sort(dependencies)
+
+		return dependencies
+	}
+
+	var ordered []workspacePackage
+	for _, name := range names {
+		workspace := packages[name]
+		workspace.Dependencies = selectedDependencies(name)
+		ordered = append(ordered, workspace)
+	}
+
+	return ordered, nil
+}
+
+// parsePnpmWorkspace returns the package patterns of pnpm-workspace.yaml, or
+// nil if there is no such file.
+func parsePnpmWorkspace(workingDir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(workingDir, "pnpm-workspace.yaml"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read pnpm-workspace.yaml: %w", err)
+	}
+
+	patterns := []string{}
+	inPackages := false
+	for _, line := range strings.Split(string(content), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Top-level keys start a new section.
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			key, _, _ := strings.Cut(line, ":")
+			inPackages = strings.TrimSpace(key) == "packages"
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(strings.TrimSpace(line), "-"); ok && inPackages {
+			patterns = append(patterns, strings.Trim(strings.TrimSpace(item), `"'`))
+		}
+	}
+
+	return patterns, nil
+}
+
+// matchesWorkspacePatterns reports whether the directory, relative to the
+// workspace root, matches one of the patterns and none of the patterns
+// negated with "!".
+func matchesWorkspacePatterns(patterns []string, dir string) bool {
+	var matched bool
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchGlob(negated, dir) {
+				return false
+			}
+			continue
+		}
+
+		matched = matched || matchGlob(pattern, dir)
+	}
+
+	return matched
+}
+
+// matchGlob matches a slash separated path against a pattern in which "**"
+// matches any number of path segments and every other segment is matched
+// with path.Match.
+func matchGlob(pattern, dir string) bool {
+	pattern = strings.Trim(strings.TrimPrefix(pattern, "./"), "/")
+
+	var match func(patterns, segments []string) bool
+	match = func(patterns, segments []string) bool {
+		if len(patterns) == 0 {
+			return len(segments) == 0
+		}
+
+		if patterns[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if match(patterns[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		ok, _ := path.Match(patterns[0], segments[0])
+		return ok && match(patterns[1:], segments[1:])
+	}
+
+	return match(strings.Split(pattern, "/"), strings.Split(dir, "/"))
+}